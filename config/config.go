@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -46,6 +48,10 @@ type ConfigInterface interface {
 	Int64(key string) (int64, error)
 	Float64(key string) (float64, error)
 	Set(key string, value string) error
+	Sections() []string
+	Keys(section string) []string
+	WriteTo(w io.Writer) (int64, error)
+	SaveFile(path string) error
 }
 
 // Config represents an implementation of the ConfigInterface
@@ -54,26 +60,67 @@ type Config struct {
 	sync.RWMutex
 	// Section:key=value
 	data map[string]map[string]string
+	// The sections and their keys in the order they were added.
+	sectionOrder []string
+	keyOrder     map[string][]string
+	// The lines of the file, to write it back with its comments and its multi-line values.
+	layout []*layoutSection
+	// The line numbers of the options, for the errors.
+	lineNums map[string]map[string]int
+	// The files being parsed, the including ones first, to detect include cycles.
+	files []string
+	// The section of the include option when the file is included, it holds the options
+	// before the first section of the file.
+	includingSection string
 }
 
+// layoutSection is a section of the file, the lines before the first section header belong to
+// the default section, which has no header.
+type layoutSection struct {
+	name   string
+	header string
+	items  []*layoutItem
+	// added is set for the sections added by Set(), they are separated from the previous one by a blank line.
+	added bool
+}
+
+// layoutItem is a comment, a blank line, or a key with its value spanning one or more lines.
+type layoutItem struct {
+	key   string
+	lines []string
+}
+
+// INCLUDE_OPTION is the option including another file, e.g. "include = common.conf". The sections of the
+// included file are merged at the position of the option, a relative path is relative to the including file.
+// The options before the first section of the included file belong to the section of the option.
+var INCLUDE_OPTION = "include"
+
+var interpolationRegex = regexp.MustCompile(`\$\{([^}]*)\}`)
+
 // NewConfig create an empty configuration representation from file.
+// The values may reference environment variables like ${HOME} and other options like ${section::key},
+// they are replaced when the values are read. A reference to an undefined variable or option is an error.
 func NewConfig(confName string) (ConfigInterface, error) {
-	c := &Config{
-		data: make(map[string]map[string]string),
-	}
+	c := newConfig()
 	err := c.parse(confName)
 	return c, err
 }
 
 // NewConfigFromText create an empty configuration representation from text.
 func NewConfigFromText(text string) (ConfigInterface, error) {
-	c := &Config{
-		data: make(map[string]map[string]string),
-	}
+	c := newConfig()
 	err := c.parseBuffer(bufio.NewReader(strings.NewReader(text)))
 	return c, err
 }
 
+func newConfig() *Config {
+	return &Config{
+		data:     make(map[string]map[string]string),
+		keyOrder: make(map[string][]string),
+		lineNums: make(map[string]map[string]int),
+	}
+}
+
 // AddConfig adds a new section->key:value to the configuration.
 func (c *Config) AddConfig(section string, option string, value string) bool {
 	if section == "" {
@@ -82,106 +129,265 @@ func (c *Config) AddConfig(section string, option string, value string) bool {
 
 	if _, ok := c.data[section]; !ok {
 		c.data[section] = make(map[string]string)
+		c.sectionOrder = append(c.sectionOrder, section)
 	}
 
 	_, ok := c.data[section][option]
 	c.data[section][option] = value
+	if !ok {
+		c.keyOrder[section] = append(c.keyOrder[section], option)
+	}
 
 	return !ok
 }
 
+// layoutSection returns the section of the layout, it is added if needed.
+func (c *Config) layoutSection(section string) *layoutSection {
+	if section == "" {
+		section = DEFAULT_SECTION
+	}
+
+	for _, ls := range c.layout {
+		if ls.name == section {
+			return ls
+		}
+	}
+
+	ls := &layoutSection{name: section}
+	if section != DEFAULT_SECTION {
+		ls.header = "[" + section + "]"
+	}
+	c.layout = append(c.layout, ls)
+	return ls
+}
+
 func (c *Config) parse(fname string) (err error) {
 	c.Lock()
+	defer c.Unlock()
 	f, err := os.Open(fname)
 	if err != nil {
 		return err
 	}
-	defer c.Unlock()
 	defer f.Close()
 
+	if path, err := filepath.Abs(fname); err == nil {
+		c.files = append(c.files, path)
+	}
 	buf := bufio.NewReader(f)
 	return c.parseBuffer(buf)
 }
 
+// include merges the sections of the file into the configuration, section is the section of the option.
+func (c *Config) include(fname string, section string, lineNum int) error {
+	path := fname
+	if !filepath.IsAbs(path) && len(c.files) > 0 {
+		path = filepath.Join(filepath.Dir(c.files[len(c.files)-1]), path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("line %d: include %s: %s", lineNum, fname, err)
+	}
+	for i, file := range c.files {
+		if file == path {
+			return fmt.Errorf("line %d: include cycle: %s", lineNum, strings.Join(append(c.files[i:], path), " -> "))
+		}
+	}
+
+	included := newConfig()
+	included.files = c.files
+	included.includingSection = section
+	if err := included.parse(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("line %d: include %s: file does not exist", lineNum, fname)
+		}
+		return fmt.Errorf("line %d: include %s: %s", lineNum, fname, err)
+	}
+
+	for _, section := range included.sectionOrder {
+		for _, option := range included.keyOrder[section] {
+			c.AddConfig(section, option, included.data[section][option])
+		}
+	}
+	return nil
+}
+
 func (c *Config) parseBuffer(buf *bufio.Reader) error {
 	var section string
 	var lineNum int
 	var buffer bytes.Buffer
-	var canWrite bool
-	for {
-		if canWrite {
-			if err := c.write(section, lineNum, &buffer); err != nil {
-				return err
-			} else {
-				canWrite = false
-			}
+	// The lines of the value being read and the number of the first one.
+	var lines []string
+	var startLineNum int
+
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		option, err := c.write(section, startLineNum, &buffer)
+		if err != nil {
+			return err
 		}
+		ls := c.layoutSection(section)
+		ls.items = append(ls.items, &layoutItem{key: option, lines: lines})
+		lines = nil
+		return nil
+	}
+
+	for {
 		lineNum++
-		line, _, err := buf.ReadLine()
+		rawLine, _, err := buf.ReadLine()
 		if err == io.EOF {
 			// force write when buffer is not flushed yet
-			if buffer.Len() > 0 {
-				if err := c.write(section, lineNum, &buffer); err != nil {
-					return err
-				}
+			if err := flush(); err != nil {
+				return err
 			}
 			break
 		} else if err != nil {
 			return err
 		}
 
-		line = bytes.TrimSpace(line)
+		raw := string(rawLine)
+		line := bytes.TrimSpace(rawLine)
 		switch {
 		case bytes.Equal(line, []byte{}), bytes.HasPrefix(line, DEFAULT_COMMENT_SEM),
 			bytes.HasPrefix(line, DEFAULT_COMMENT):
-			canWrite = true
-			continue
+			if err := flush(); err != nil {
+				return err
+			}
+			ls := c.layoutSection(section)
+			ls.items = append(ls.items, &layoutItem{lines: []string{raw}})
 		case bytes.HasPrefix(line, []byte{'['}) && bytes.HasSuffix(line, []byte{']'}):
 			// force write when buffer is not flushed yet
-			if buffer.Len() > 0 {
-				if err := c.write(section, lineNum, &buffer); err != nil {
-					return err
-				}
-				canWrite = false
+			if err := flush(); err != nil {
+				return err
 			}
 			section = string(line[1 : len(line)-1])
+			c.layoutSection(section).header = raw
 		default:
+			if len(lines) == 0 {
+				startLineNum = lineNum
+			}
+			lines = append(lines, raw)
 			var p []byte
 			if bytes.HasSuffix(line, DEFAULT_MULTI_LINE_SEPARATOR) {
 				p = bytes.TrimSpace(line[:len(line)-1])
 			} else {
 				p = line
-				canWrite = true
 			}
 
 			if _, err := buffer.Write(p); err != nil {
 				return err
 			}
+			if !bytes.HasSuffix(line, DEFAULT_MULTI_LINE_SEPARATOR) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
-	return nil
+	// The references of an included file are checked once it is merged into the including one.
+	if c.includingSection != "" {
+		return nil
+	}
+	return c.checkInterpolation()
 }
 
-func (c *Config) write(section string, lineNum int, b *bytes.Buffer) error {
+// write adds the option of the buffer to the section and returns its name.
+func (c *Config) write(section string, lineNum int, b *bytes.Buffer) (string, error) {
 	if b.Len() <= 0 {
-		return nil
+		return "", nil
 	}
 
 	optionVal := bytes.SplitN(b.Bytes(), []byte{'='}, 2)
 	if len(optionVal) != 2 {
-		return fmt.Errorf("parse the content error : line %d , %s = ? ", lineNum, optionVal[0])
+		return "", fmt.Errorf("parse the content error : line %d , %s = ? ", lineNum, optionVal[0])
 	}
 	option := bytes.TrimSpace(optionVal[0])
 	value := bytes.TrimSpace(optionVal[1])
-	c.AddConfig(section, string(option), string(value))
-
 	// flush buffer after adding
 	b.Reset()
 
+	if section == "" {
+		section = c.includingSection
+	}
+	if section == "" {
+		section = DEFAULT_SECTION
+	}
+	if string(option) == INCLUDE_OPTION {
+		return string(option), c.include(string(value), section, lineNum)
+	}
+
+	c.AddConfig(section, string(option), string(value))
+	if _, ok := c.lineNums[section]; !ok {
+		c.lineNums[section] = make(map[string]int)
+	}
+	c.lineNums[section][string(option)] = lineNum
+
+	return string(option), nil
+}
+
+// checkInterpolation reports the options referencing themselves through ${section::key}.
+func (c *Config) checkInterpolation() error {
+	for _, section := range c.sectionOrder {
+		for _, option := range c.keyOrder[section] {
+			key := section + "::" + option
+			if _, err := c.interpolate(c.data[section][option], []string{key}); err != nil {
+				if lineNum, ok := c.lineNums[section][option]; ok {
+					return fmt.Errorf("line %d: %s: %s", lineNum, key, err)
+				}
+				return fmt.Errorf("%s: %s", key, err)
+			}
+		}
+	}
 	return nil
 }
 
+// interpolate replaces the references in value by the environment variables or the options they name,
+// stack holds the options being interpolated.
+func (c *Config) interpolate(value string, stack []string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var err error
+	res := interpolationRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if !strings.Contains(name, "::") {
+			v, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("environment variable %q is not set", name)
+			}
+			return v
+		}
+
+		keys := strings.SplitN(strings.ToLower(name), "::", 2)
+		key := keys[0] + "::" + keys[1]
+		for i, k := range stack {
+			if k == key && err == nil {
+				err = fmt.Errorf("interpolation cycle: %s", strings.Join(append(stack[i:], key), " -> "))
+			}
+		}
+		if err != nil {
+			return ""
+		}
+
+		option, ok := c.data[keys[0]][keys[1]]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("%s is not defined", key)
+			}
+			return ""
+		}
+		v, e := c.interpolate(option, append(stack, key))
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	})
+	return res, err
+}
+
 // Bool lookups up the value using the provided key and converts the value to a bool
 func (c *Config) Bool(key string) (bool, error) {
 	return strconv.ParseBool(c.get(key))
@@ -239,9 +445,98 @@ func (c *Config) Set(key string, value string) error {
 	}
 
 	c.AddConfig(section, option, value)
+	c.setLayout(section, option, value)
 	return nil
 }
 
+// setLayout replaces the lines of the option in the layout, a new option is added after
+// the last option of its section.
+func (c *Config) setLayout(section string, option string, value string) {
+	n := len(c.layout)
+	ls := c.layoutSection(section)
+	if len(c.layout) > n {
+		ls.added = true
+	}
+	item := &layoutItem{key: option, lines: []string{option + " = " + value}}
+
+	last := -1
+	for i, it := range ls.items {
+		if it.key == option {
+			ls.items[i] = item
+			return
+		}
+		if it.key != "" {
+			last = i
+		}
+	}
+
+	ls.items = append(ls.items, nil)
+	copy(ls.items[last+2:], ls.items[last+1:])
+	ls.items[last+1] = item
+}
+
+// Sections returns the names of the sections in the order they appear in the configuration.
+func (c *Config) Sections() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.sectionOrder...)
+}
+
+// Keys returns the keys of the section in the order they appear in the configuration.
+func (c *Config) Keys(section string) []string {
+	c.RLock()
+	defer c.RUnlock()
+	if section == "" {
+		section = DEFAULT_SECTION
+	}
+	return append([]string(nil), c.keyOrder[strings.ToLower(section)]...)
+}
+
+// WriteTo writes the configuration in the INI format. The comments, the blank lines and the
+// multi-line values are written as they were read, the values changed by Set() on a single line.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	var b bytes.Buffer
+	blank := true
+	writeLine := func(line string) {
+		b.WriteString(line)
+		b.WriteString("\n")
+		blank = strings.TrimSpace(line) == ""
+	}
+
+	for _, ls := range c.layout {
+		if ls.header != "" {
+			if ls.added && !blank && b.Len() > 0 {
+				writeLine("")
+			}
+			writeLine(ls.header)
+		}
+		for _, item := range ls.items {
+			for _, line := range item.lines {
+				writeLine(line)
+			}
+		}
+	}
+
+	return b.WriteTo(w)
+}
+
+// SaveFile writes the configuration to the file at path, see WriteTo().
+func (c *Config) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 // section.key or key
 func (c *Config) get(key string) string {
 	var (
@@ -259,6 +554,9 @@ func (c *Config) get(key string) string {
 	}
 
 	if value, ok := c.data[section][option]; ok {
+		if res, err := c.interpolate(value, []string{section + "::" + option}); err == nil {
+			return res
+		}
 		return value
 	}
 
@@ -15,6 +15,11 @@
 package config
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -83,3 +88,187 @@ func TestGet(t *testing.T) {
 		t.Errorf("Get failure: expected different value for multi5::name (expected: [%#v] got: [%#v])", "r.sub==p.sub&&r.obj==p.obj", v)
 	}
 }
+
+func TestSectionsAndKeys(t *testing.T) {
+	config, err := NewConfig("testdata/testini.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sections := config.Sections()
+	expected := []string{"default", "redis", "mysql", "math", "multi1", "multi2", "multi3", "multi4", "multi5"}
+	if strings.Join(sections, ",") != strings.Join(expected, ",") {
+		t.Errorf("Sections: %v, supposed to be %v", sections, expected)
+	}
+
+	keys := config.Keys("mysql")
+	expected = []string{"mysql.dev.host", "mysql.dev.user", "mysql.dev.pass", "mysql.dev.db",
+		"mysql.master.host", "mysql.master.user", "mysql.master.pass", "mysql.master.db"}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("Keys: %v, supposed to be %v", keys, expected)
+	}
+	if keys := config.Keys(""); strings.Join(keys, ",") != "debug,url" {
+		t.Errorf("Keys of the default section: %v", keys)
+	}
+	if keys := config.Keys("none"); len(keys) != 0 {
+		t.Errorf("Keys of an unknown section: %v", keys)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	for _, file := range []string{"testdata/testini.ini", "../examples/rbac_model_in_multi_line.conf"} {
+		data, _ := ioutil.ReadFile(file)
+		config, err := NewConfig(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+		if _, err := config.WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != strings.TrimSuffix(string(data), "\n")+"\n" {
+			t.Errorf("%s is not written back as it was read:\n%s", file, b.String())
+		}
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	config, err := NewConfig("../examples/rbac_model_in_multi_line.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = config.Set("policy_effect::e", "!some(where (p.eft == deny))")
+	_ = config.Set("role_definition::g2", "_, _")
+	_ = config.Set("comments::key", "value")
+
+	path := filepath.Join(t.TempDir(), "model.conf")
+	if err := config.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	expected := `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+g2 = _, _
+
+[policy_effect]
+e = !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj \
+ && r.act == p.act
+
+[comments]
+key = value
+`
+	if string(data) != expected {
+		t.Errorf("%s, supposed to be %s", data, expected)
+	}
+
+	saved, err := NewConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"policy_effect::e", "role_definition::g2", "matchers::m", "comments::key"} {
+		if saved.String(key) != config.String(key) {
+			t.Errorf("%s: %s, supposed to be %s", key, saved.String(key), config.String(key))
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	os.Setenv("CASBIN_TEST_DOMAIN", "domain1")
+	defer os.Unsetenv("CASBIN_TEST_DOMAIN")
+	config, err := NewConfigFromText(`
+[request_definition]
+r = sub, obj, act
+home = ${CASBIN_TEST_DOMAIN}/${request_definition::r}
+
+[matchers]
+m = r.obj == "${request_definition::home}"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := config.String("request_definition::home"); v != "domain1/sub, obj, act" {
+		t.Errorf("request_definition::home: %q, supposed to be %q", v, "domain1/sub, obj, act")
+	}
+	if v := config.String("matchers::m"); v != `r.obj == "domain1/sub, obj, act"` {
+		t.Errorf("matchers::m: %q", v)
+	}
+
+	_, err = NewConfigFromText(`
+[matchers]
+m = r.sub == p.sub
+m2 = ${matchers::m3}
+m3 = ${matchers::m2}
+`)
+	if err == nil || err.Error() != "line 4: matchers::m2: interpolation cycle: matchers::m2 -> matchers::m3 -> matchers::m2" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = NewConfigFromText(`
+[matchers]
+m = r.sub == p.sub && ${CASBIN_TEST_UNSET}
+`)
+	if err == nil || err.Error() != `line 3: matchers::m: environment variable "CASBIN_TEST_UNSET" is not set` {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = NewConfigFromText(`
+[matchers]
+m = r.sub == p.sub && ${matchers::domain}
+`)
+	if err == nil || err.Error() != "line 3: matchers::m: matchers::domain is not defined" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	os.Setenv("CASBIN_TEST_DOMAIN", "domain1")
+	defer os.Unsetenv("CASBIN_TEST_DOMAIN")
+	config, err := NewConfig("testdata/include.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := strings.Join(config.Sections(), ","); v != "request_definition,policy_definition,matchers" {
+		t.Errorf("sections: %s", v)
+	}
+	if v := config.String("policy_definition::p"); v != "sub, obj, act" {
+		t.Errorf("policy_definition::p: %q", v)
+	}
+	if v := config.String("matchers::m"); v != `r.sub == p.sub && r.dom == "domain1" && r.obj == p.obj` {
+		t.Errorf("matchers::m: %q", v)
+	}
+	if v := config.String("domain"); v != "" {
+		t.Errorf("the options of an included file should not be added to the default section, got %q", v)
+	}
+
+	// The include is written back as is.
+	var buf bytes.Buffer
+	if _, err := config.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := ioutil.ReadFile("testdata/include.conf")
+	if buf.String() != string(text) {
+		t.Errorf("WriteTo:\n%s\nsupposed to be:\n%s", buf.String(), text)
+	}
+
+	_, err = NewConfig("testdata/include_cycle.conf")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3: include include_cycle2.conf: line 4: include cycle: ") ||
+		!strings.HasSuffix(err.Error(), filepath.Join("testdata", "include_cycle.conf")) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = NewConfig("testdata/include_missing.conf")
+	if err == nil || err.Error() != "line 4: include missing.conf: file does not exist" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -14,8 +14,6 @@
 
 package effect
 
-import "errors"
-
 // DefaultEffector is default effector for Casbin.
 type DefaultEffector struct {
 }
@@ -27,49 +25,25 @@ func NewDefaultEffector() *DefaultEffector {
 }
 
 // MergeEffects merges all matching results collected by the enforcer into a single decision.
-func (e *DefaultEffector) MergeEffects(expr string, effects []Effect, results []float64) (bool, error) {
-	result := false
-	if expr == "some(where (p_eft == allow))" {
-		result = false
-		for _, eft := range effects {
-			if eft == Allow {
-				result = true
-				break
-			}
-		}
-	} else if expr == "!some(where (p_eft == deny))" {
-		result = true
-		for _, eft := range effects {
-			if eft == Deny {
-				result = false
-				break
-			}
-		}
-	} else if expr == "some(where (p_eft == allow)) && !some(where (p_eft == deny))" {
-		result = false
-		for _, eft := range effects {
-			if eft == Allow {
-				result = true
-			} else if eft == Deny {
-				result = false
-				break
-			}
-		}
-	} else if expr == "priority(p_eft) || deny" {
-		result = false
-		for _, eft := range effects {
-			if eft != Indeterminate {
-				if eft == Allow {
-					result = true
-				} else {
-					result = false
-				}
-				break
-			}
-		}
-	} else {
-		return false, errors.New("unsupported effect")
+// The expression is compiled on every call, see Compile() for the supported grammar. The enforcer
+// evaluates the expressions it compiled for its model instead.
+func (e *DefaultEffector) MergeEffects(expr string, effects []Effect, results []float64) (bool, int, error) {
+	expression, err := Compile(expr)
+	if err != nil {
+		return false, -1, err
+	}
+
+	result, explainIndex := expression.Evaluate(effects)
+	return result, explainIndex, nil
+}
+
+// NewDecision returns a Decision for the policy effect expr, so that the enforcer can stop
+// as soon as a rule decides the result, e.g. the first matching rule for "priority(p_eft) || deny".
+func (e *DefaultEffector) NewDecision(expr string) (Decision, error) {
+	expression, err := Compile(expr)
+	if err != nil {
+		return nil, err
 	}
 
-	return result, nil
+	return expression.NewDecision(), nil
 }
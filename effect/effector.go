@@ -27,5 +27,37 @@ const (
 // Effector is the interface for Casbin effectors.
 type Effector interface {
 	// MergeEffects merges all matching results collected by the enforcer into a single decision.
-	MergeEffects(expr string, effects []Effect, results []float64) (bool, error)
+	// It also returns the index of the policy rule that decided the result, or -1 when
+	// no single rule can be held responsible (e.g. nothing matched).
+	MergeEffects(expr string, effects []Effect, results []float64) (bool, int, error)
 }
+
+// Decider is implemented by the effectors able to tell that the result of an enforcement is final
+// before all the policy rules are evaluated. The enforcer then stops evaluating the rules and merges
+// the effects of the ones evaluated so far.
+type Decider interface {
+	// NewDecision returns a Decision for the policy effect expr.
+	NewDecision(expr string) (Decision, error)
+}
+
+// Decision follows the effects of the policy rules of a single enforcement in order.
+type Decision interface {
+	// Add records the effect of the rule at index and reports whether the result is final,
+	// i.e. it does not depend on the effects of the following rules. The rules are added in
+	// ascending order, the ones not added are Indeterminate.
+	Add(index int, eft Effect) bool
+}
+
+// The policy effects of the usual models, for building models in code.
+const (
+	// AllowOverride allows the request if a matching rule allows it.
+	AllowOverride = "some(where (p.eft == allow))"
+	// DenyOverride allows the request unless a matching rule denies it.
+	DenyOverride = "!some(where (p.eft == deny))"
+	// AllowAndDeny allows the request if a matching rule allows it and no matching rule denies it.
+	AllowAndDeny = "some(where (p.eft == allow)) && !some(where (p.eft == deny))"
+	// Priority takes the effect of the first matching rule.
+	Priority = "priority(p.eft) || deny"
+	// SubjectPriority takes the effect of the matching rule whose subject is the closest to the subject of the request.
+	SubjectPriority = "subjectPriority(p.eft) || deny"
+)
@@ -0,0 +1,599 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effect
+
+import (
+	"fmt"
+)
+
+// decision is the three-valued result of a policy effect expression.
+type decision int
+
+const (
+	undecided decision = iota
+	allowed
+	denied
+)
+
+// Expression is a compiled policy effect, i.e. the value of the [policy_effect] section.
+//
+// The grammar is:
+//
+//	expr     = and { "||" and }
+//	and      = unary { "&&" unary }
+//	unary    = "!" unary | primary
+//	primary  = "(" expr ")" | quantor | ( "priority" | "subjectPriority" ) "(" eft ")" | "allow" | "deny" | algorithm
+//	quantor  = "some" "(" "where" "(" eft "==" ( "allow" | "deny" ) ")" ")"
+//	eft      = "p_eft" | "p2_eft" | ...
+//	algorithm = "deny-overrides" | "permit-overrides" | "first-applicable" | "only-one-applicable" |
+//	            "deny-unless-permit" | "permit-unless-deny"
+//
+// "some" is true when a matching rule has the effect, "priority" takes the effect of the first matching rule
+// and is undecided when no rule matches. "subjectPriority" is "priority" for the effects ordered by how close
+// the subjects of the rules are to the subject of the request, the enforcer orders them. "&&", "||" and "!" follow the three-valued logic of Kleene,
+// an undecided expression denies the request. The rule held responsible for a decision is the one of
+// the operand that decided it, preferring the left one.
+//
+// The algorithms are the rule-combining algorithms of XACML 3.0. A matching rule with the effect allow
+// or deny is a Permit or a Deny rule, the rules that do not match, i.e. whose effect is Indeterminate,
+// are NotApplicable. A combined result that is NotApplicable or Indeterminate is undecided:
+//
+//	deny-overrides       Deny if a rule denies, else Permit if a rule permits, else NotApplicable.
+//	permit-overrides     Permit if a rule permits, else Deny if a rule denies, else NotApplicable.
+//	first-applicable     The effect of the first matching rule, NotApplicable if none matches.
+//	only-one-applicable  The effect of the matching rule if exactly one matches, Indeterminate if more
+//	                     than one matches, NotApplicable if none matches.
+//	deny-unless-permit   Permit if a rule permits, else Deny.
+//	permit-unless-deny   Deny if a rule denies, else Permit.
+type Expression struct {
+	text            string
+	root            node
+	subjectPriority bool
+}
+
+// Compile parses a policy effect expression. The expression can be evaluated concurrently,
+// it should be compiled once and kept, e.g. for the lifetime of the model.
+func Compile(expr string) (*Expression, error) {
+	p := &parser{expr: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, p.unexpected()
+	}
+
+	return &Expression{text: expr, root: root, subjectPriority: p.subjectPriority}, nil
+}
+
+// String returns the text the expression was compiled from.
+func (e *Expression) String() string {
+	return e.text
+}
+
+// HasSubjectPriority determines whether the expression uses "subjectPriority", i.e. whether the effects
+// have to be ordered by the distance of the subjects of their rules to the subject of the request.
+func (e *Expression) HasSubjectPriority() bool {
+	return e.subjectPriority
+}
+
+// Evaluate merges the effects of the matching policy rules into a decision. It also returns the index of
+// the rule that decided the result, or -1 when no single rule can be held responsible.
+func (e *Expression) Evaluate(effects []Effect) (bool, int) {
+	s := newSummary()
+	for i, eft := range effects {
+		s.add(i, eft)
+	}
+	d, index := e.root.eval(s)
+	return d == allowed, index
+}
+
+// NewDecision returns a Decision following the effects of the rules of one enforcement.
+func (e *Expression) NewDecision() Decision {
+	return &expressionDecision{root: e.root, summary: newSummary()}
+}
+
+type expressionDecision struct {
+	root    node
+	summary *summary
+}
+
+func (d *expressionDecision) Add(index int, eft Effect) bool {
+	d.summary.add(index, eft)
+	return d.root.decided(d.summary)
+}
+
+// summary records the effects of the rules the value of every expression depends on.
+// The positions never change once set, so a decided expression stays decided.
+type summary struct {
+	firstAllow       int
+	firstDeny        int
+	firstApplicable  int
+	secondApplicable int
+}
+
+func newSummary() *summary {
+	return &summary{firstAllow: -1, firstDeny: -1, firstApplicable: -1, secondApplicable: -1}
+}
+
+func (s *summary) add(index int, eft Effect) {
+	switch eft {
+	case Allow:
+		if s.firstAllow == -1 {
+			s.firstAllow = index
+		}
+	case Deny:
+		if s.firstDeny == -1 {
+			s.firstDeny = index
+		}
+	}
+	if eft != Indeterminate {
+		if s.firstApplicable == -1 {
+			s.firstApplicable = index
+		} else if s.secondApplicable == -1 {
+			s.secondApplicable = index
+		}
+	}
+}
+
+// firstApplicableDecision returns the effect of the first matching rule.
+func (s *summary) firstApplicableDecision() (decision, int) {
+	switch s.firstApplicable {
+	case -1:
+		return undecided, -1
+	case s.firstAllow:
+		return allowed, s.firstAllow
+	}
+	return denied, s.firstDeny
+}
+
+type node interface {
+	eval(s *summary) (decision, int)
+	// decided reports whether the value can not change whatever the effects of the following rules are.
+	decided(s *summary) bool
+}
+
+// someNode is "some(where (p_eft == effect))".
+type someNode struct {
+	effect Effect
+}
+
+func (n someNode) first(s *summary) int {
+	if n.effect == Allow {
+		return s.firstAllow
+	}
+	return s.firstDeny
+}
+
+func (n someNode) eval(s *summary) (decision, int) {
+	if i := n.first(s); i != -1 {
+		return allowed, i
+	}
+	return denied, -1
+}
+
+func (n someNode) decided(s *summary) bool {
+	return n.first(s) != -1
+}
+
+// priorityNode is "priority(p_eft)", "subjectPriority(p_eft)" and "first-applicable".
+type priorityNode struct {
+	// bySubject is set for "subjectPriority", the effects are ordered after all the rules are evaluated,
+	// so the order of evaluation can not decide the result.
+	bySubject bool
+}
+
+func (priorityNode) eval(s *summary) (decision, int) {
+	return s.firstApplicableDecision()
+}
+
+func (n priorityNode) decided(s *summary) bool {
+	return !n.bySubject && s.firstApplicable != -1
+}
+
+// overridesNode is "deny-overrides" and "permit-overrides".
+type overridesNode struct {
+	effect Effect
+}
+
+func (n overridesNode) eval(s *summary) (decision, int) {
+	if n.effect == Deny {
+		if s.firstDeny != -1 {
+			return denied, s.firstDeny
+		} else if s.firstAllow != -1 {
+			return allowed, s.firstAllow
+		}
+	} else {
+		if s.firstAllow != -1 {
+			return allowed, s.firstAllow
+		} else if s.firstDeny != -1 {
+			return denied, s.firstDeny
+		}
+	}
+	return undecided, -1
+}
+
+func (n overridesNode) decided(s *summary) bool {
+	if n.effect == Deny {
+		return s.firstDeny != -1
+	}
+	return s.firstAllow != -1
+}
+
+// onlyOneApplicableNode is "only-one-applicable".
+type onlyOneApplicableNode struct{}
+
+func (onlyOneApplicableNode) eval(s *summary) (decision, int) {
+	if s.secondApplicable != -1 {
+		return undecided, -1
+	}
+	return s.firstApplicableDecision()
+}
+
+func (onlyOneApplicableNode) decided(s *summary) bool {
+	return s.secondApplicable != -1
+}
+
+// unlessNode is "deny-unless-permit" and "permit-unless-deny", the effect is the one that
+// takes the place of the default.
+type unlessNode struct {
+	effect Effect
+}
+
+func (n unlessNode) eval(s *summary) (decision, int) {
+	if n.effect == Allow {
+		if s.firstAllow != -1 {
+			return allowed, s.firstAllow
+		}
+		return denied, s.firstDeny
+	}
+	if s.firstDeny != -1 {
+		return denied, s.firstDeny
+	}
+	return allowed, s.firstAllow
+}
+
+func (n unlessNode) decided(s *summary) bool {
+	if n.effect == Allow {
+		return s.firstAllow != -1
+	}
+	return s.firstDeny != -1
+}
+
+// literalNode is "allow" or "deny".
+type literalNode struct {
+	decision decision
+}
+
+func (n literalNode) eval(*summary) (decision, int) {
+	return n.decision, -1
+}
+
+func (literalNode) decided(*summary) bool {
+	return true
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) eval(s *summary) (decision, int) {
+	d, index := n.operand.eval(s)
+	switch d {
+	case allowed:
+		return denied, index
+	case denied:
+		return allowed, index
+	}
+	return undecided, index
+}
+
+func (n notNode) decided(s *summary) bool {
+	return n.operand.decided(s)
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) eval(s *summary) (decision, int) {
+	l, li := n.left.eval(s)
+	r, ri := n.right.eval(s)
+	switch {
+	case l == denied && r == denied:
+		return denied, firstIndex(li, ri)
+	case l == denied:
+		return denied, li
+	case r == denied:
+		return denied, ri
+	}
+	if l == undecided || r == undecided {
+		return undecided, -1
+	}
+	return allowed, firstIndex(li, ri)
+}
+
+func (n andNode) decided(s *summary) bool {
+	return isDecidedAs(n.left, n.right, s, denied)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) eval(s *summary) (decision, int) {
+	l, li := n.left.eval(s)
+	r, ri := n.right.eval(s)
+	switch {
+	case l == allowed && r == allowed:
+		return allowed, firstIndex(li, ri)
+	case l == allowed:
+		return allowed, li
+	case r == allowed:
+		return allowed, ri
+	}
+	if l == undecided || r == undecided {
+		return undecided, -1
+	}
+	return denied, firstIndex(li, ri)
+}
+
+func (n orNode) decided(s *summary) bool {
+	return isDecidedAs(n.left, n.right, s, allowed)
+}
+
+// isDecidedAs determines whether a binary operator is decided, i.e. both of its operands are,
+// or one of them is decided with the value d that decides the operator alone.
+func isDecidedAs(left, right node, s *summary, d decision) bool {
+	ld, rd := left.decided(s), right.decided(s)
+	if ld && rd {
+		return true
+	}
+	if ld {
+		v, _ := left.eval(s)
+		return v == d
+	}
+	if rd {
+		v, _ := right.eval(s)
+		return v == d
+	}
+	return false
+}
+
+func firstIndex(indexes ...int) int {
+	for _, index := range indexes {
+		if index != -1 {
+			return index
+		}
+	}
+	return -1
+}
+
+type token struct {
+	text string
+	pos  int
+}
+
+type parser struct {
+	expr            string
+	tokens          []token
+	pos             int
+	subjectPriority bool
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *parser) tokenize() error {
+	for i := 0; i < len(p.expr); {
+		c := p.expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			p.tokens = append(p.tokens, token{text: p.expr[i : i+1], pos: i})
+			i++
+		case c == '!' && (i+1 == len(p.expr) || p.expr[i+1] != '='):
+			p.tokens = append(p.tokens, token{text: "!", pos: i})
+			i++
+		case i+1 < len(p.expr) && (p.expr[i:i+2] == "&&" || p.expr[i:i+2] == "||" || p.expr[i:i+2] == "=="):
+			p.tokens = append(p.tokens, token{text: p.expr[i : i+2], pos: i})
+			i += 2
+		case isIdentifierChar(c):
+			start := i
+			for i < len(p.expr) && isIdentifierChar(p.expr[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, token{text: p.expr[start:i], pos: start})
+		default:
+			return fmt.Errorf("invalid policy effect %q: unexpected character %q at position %d", p.expr, c, i)
+		}
+	}
+	return nil
+}
+
+func (p *parser) peek() string {
+	if p.pos == len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+func (p *parser) unexpected() error {
+	if p.pos == len(p.tokens) {
+		return fmt.Errorf("invalid policy effect %q: unexpected end of expression", p.expr)
+	}
+	t := p.tokens[p.pos]
+	return fmt.Errorf("invalid policy effect %q: unexpected token %q at position %d", p.expr, t.text, t.pos)
+}
+
+func (p *parser) expect(texts ...string) error {
+	for _, text := range texts {
+		if p.peek() != text {
+			return p.unexpected()
+		}
+		p.pos++
+	}
+	return nil
+}
+
+// expectEffectToken accepts the effect token of a policy type like "p" or "p2", escaped or not.
+// The enforcer reads the effects of the policy type the request is evaluated against.
+func (p *parser) expectEffectToken() error {
+	if !isEffectToken(p.peek()) {
+		return p.unexpected()
+	}
+	p.pos++
+	return nil
+}
+
+// isEffectToken determines whether t is "p_eft", "p.eft", "p2_eft", "p2.eft", etc.
+func isEffectToken(t string) bool {
+	if len(t) < len("p_eft") || t[0] != 'p' {
+		return false
+	}
+	i := 1
+	for i < len(t) && t[i] >= '0' && t[i] <= '9' {
+		i++
+	}
+	return t[i:] == "_eft" || t[i:] == ".eft"
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peek() == "!" {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	switch p.peek() {
+	case "(":
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case "some":
+		p.pos++
+		if err := p.expect("(", "where", "("); err != nil {
+			return nil, err
+		}
+		if err := p.expectEffectToken(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("=="); err != nil {
+			return nil, err
+		}
+		var n someNode
+		switch p.peek() {
+		case "allow":
+			n.effect = Allow
+		case "deny":
+			n.effect = Deny
+		default:
+			return nil, p.unexpected()
+		}
+		p.pos++
+		if err := p.expect(")", ")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case "priority", "subjectPriority":
+		n := priorityNode{bySubject: p.peek() == "subjectPriority"}
+		p.subjectPriority = p.subjectPriority || n.bySubject
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		if err := p.expectEffectToken(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case "first-applicable":
+		p.pos++
+		return priorityNode{}, nil
+	case "deny-overrides":
+		p.pos++
+		return overridesNode{effect: Deny}, nil
+	case "permit-overrides":
+		p.pos++
+		return overridesNode{effect: Allow}, nil
+	case "only-one-applicable":
+		p.pos++
+		return onlyOneApplicableNode{}, nil
+	case "deny-unless-permit":
+		p.pos++
+		return unlessNode{effect: Allow}, nil
+	case "permit-unless-deny":
+		p.pos++
+		return unlessNode{effect: Deny}, nil
+	case "allow":
+		p.pos++
+		return literalNode{decision: allowed}, nil
+	case "deny":
+		p.pos++
+		return literalNode{decision: denied}, nil
+	}
+	return nil, p.unexpected()
+}
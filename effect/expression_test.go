@@ -0,0 +1,234 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effect
+
+import (
+	"strings"
+	"testing"
+)
+
+func testEvaluate(t *testing.T, expr string, effects []Effect, res bool, index int) {
+	t.Helper()
+	e, err := Compile(expr)
+	if err != nil {
+		t.Fatalf("%s: %s", expr, err)
+	}
+	myRes, myIndex := e.Evaluate(effects)
+	if myRes != res || myIndex != index {
+		t.Errorf("%s, %v: %t, %d, supposed to be %t, %d", expr, effects, myRes, myIndex, res, index)
+	}
+}
+
+func TestBuiltinEffects(t *testing.T) {
+	allowOverride := "some(where (p_eft == allow))"
+	testEvaluate(t, allowOverride, []Effect{}, false, -1)
+	testEvaluate(t, allowOverride, []Effect{Indeterminate, Deny, Allow}, true, 2)
+	testEvaluate(t, allowOverride, []Effect{Deny, Indeterminate}, false, -1)
+
+	denyOverride := "!some(where (p_eft == deny))"
+	testEvaluate(t, denyOverride, []Effect{}, true, -1)
+	testEvaluate(t, denyOverride, []Effect{Allow, Deny}, false, 1)
+	testEvaluate(t, denyOverride, []Effect{Allow, Indeterminate}, true, -1)
+
+	allowAndDeny := "some(where (p_eft == allow)) && !some(where (p_eft == deny))"
+	testEvaluate(t, allowAndDeny, []Effect{}, false, -1)
+	testEvaluate(t, allowAndDeny, []Effect{Indeterminate, Allow}, true, 1)
+	testEvaluate(t, allowAndDeny, []Effect{Allow, Deny}, false, 1)
+	testEvaluate(t, allowAndDeny, []Effect{Deny}, false, 0)
+
+	priority := "priority(p_eft) || deny"
+	testEvaluate(t, priority, []Effect{}, false, -1)
+	testEvaluate(t, priority, []Effect{Indeterminate, Allow, Deny}, true, 1)
+	testEvaluate(t, priority, []Effect{Indeterminate, Deny, Allow}, false, 1)
+}
+
+func TestEffectCombinations(t *testing.T) {
+	// Whitespace does not matter.
+	testEvaluate(t, "some(where(p_eft==allow))&&!some( where ( p_eft == deny ) )", []Effect{Allow}, true, 0)
+	// The unescaped effect token is accepted too.
+	testEvaluate(t, "some(where (p.eft == allow))", []Effect{Allow}, true, 0)
+
+	// Allowed when no rule denies or some rule allows.
+	expr := "!some(where (p_eft == deny)) || some(where (p_eft == allow))"
+	testEvaluate(t, expr, []Effect{Deny, Allow}, true, 1)
+	testEvaluate(t, expr, []Effect{Deny}, false, 0)
+	testEvaluate(t, expr, []Effect{}, true, -1)
+
+	// An undecided expression denies, even when negated.
+	testEvaluate(t, "priority(p_eft)", []Effect{Indeterminate}, false, -1)
+	// The effects of the other policy types.
+	testEvaluate(t, "some(where (p2_eft == allow)) && !some(where (p2.eft == deny))", []Effect{Allow, Deny}, false, 1)
+	testEvaluate(t, "priority(p10.eft)", []Effect{Indeterminate, Allow}, true, 1)
+	testEvaluate(t, "!priority(p_eft)", []Effect{Indeterminate}, false, -1)
+
+	// "&&" binds stronger than "||".
+	expr = "some(where (p_eft == deny)) && deny || some(where (p_eft == allow))"
+	testEvaluate(t, expr, []Effect{Allow}, true, 0)
+	expr = "(some(where (p_eft == deny)) || allow) && some(where (p_eft == allow))"
+	testEvaluate(t, expr, []Effect{Allow}, true, 0)
+	testEvaluate(t, expr, []Effect{Deny}, false, -1)
+}
+
+func TestEffectParseErrors(t *testing.T) {
+	testCases := []struct {
+		expr  string
+		token string
+	}{
+		{"", "unexpected end"},
+		{"some(where (p_eft == allow)", "unexpected end"},
+		{"some(where (p_eft == maybe))", `"maybe" at position 21`},
+		{"some(where (p_sub == allow))", `"p_sub" at position 12`},
+		{"some(where (p2x_eft == allow))", `"p2x_eft" at position 12`},
+		{"priority(r_eft)", `"r_eft" at position 9`},
+		{"some(where (p_eft == allow)) and deny", `"and" at position 29`},
+		{"priority(p_eft) | deny", `'|' at position 16`},
+		{"allow && || deny", `"||" at position 9`},
+	}
+	for _, tc := range testCases {
+		_, err := Compile(tc.expr)
+		if err == nil {
+			t.Errorf("%q should not compile", tc.expr)
+		} else if !strings.Contains(err.Error(), tc.token) {
+			t.Errorf("%q: the error %q should contain %s", tc.expr, err, tc.token)
+		}
+	}
+}
+
+func TestRuleCombiningAlgorithms(t *testing.T) {
+	I, A, D := Indeterminate, Allow, Deny
+	testCases := []struct {
+		expr    string
+		effects []Effect
+		res     bool
+		index   int
+	}{
+		{"deny-overrides", []Effect{}, false, -1},
+		{"deny-overrides", []Effect{I, A, I}, true, 1},
+		{"deny-overrides", []Effect{A, I, D}, false, 2},
+		{"deny-overrides", []Effect{D, A, D}, false, 0},
+
+		{"permit-overrides", []Effect{}, false, -1},
+		{"permit-overrides", []Effect{I, D, I}, false, 1},
+		{"permit-overrides", []Effect{D, I, A}, true, 2},
+		{"permit-overrides", []Effect{A, D, A}, true, 0},
+
+		{"first-applicable", []Effect{}, false, -1},
+		{"first-applicable", []Effect{I, I}, false, -1},
+		{"first-applicable", []Effect{I, A, D}, true, 1},
+		{"first-applicable", []Effect{I, D, A}, false, 1},
+
+		{"only-one-applicable", []Effect{}, false, -1},
+		{"only-one-applicable", []Effect{I, A, I}, true, 1},
+		{"only-one-applicable", []Effect{I, D, I}, false, 1},
+		{"only-one-applicable", []Effect{A, I, A}, false, -1},
+		{"only-one-applicable", []Effect{A, D}, false, -1},
+
+		{"deny-unless-permit", []Effect{}, false, -1},
+		{"deny-unless-permit", []Effect{I, D}, false, 1},
+		{"deny-unless-permit", []Effect{D, A}, true, 1},
+
+		{"permit-unless-deny", []Effect{}, true, -1},
+		{"permit-unless-deny", []Effect{I, A}, true, 1},
+		{"permit-unless-deny", []Effect{A, D}, false, 1},
+	}
+	for _, tc := range testCases {
+		testEvaluate(t, tc.expr, tc.effects, tc.res, tc.index)
+	}
+
+	// NotApplicable and Indeterminate results are undecided, they differ from Deny when combined.
+	testEvaluate(t, "permit-overrides || allow", []Effect{I}, true, -1)
+	testEvaluate(t, "permit-overrides || allow", []Effect{D}, true, -1)
+	testEvaluate(t, "!permit-overrides", []Effect{I}, false, -1)
+	testEvaluate(t, "!deny-unless-permit", []Effect{I}, true, -1)
+	testEvaluate(t, "!only-one-applicable", []Effect{A, A}, false, -1)
+	testEvaluate(t, "!only-one-applicable", []Effect{D}, true, 0)
+}
+
+// TestDecision checks that a decision is only final when no following effect can change the result.
+func TestDecision(t *testing.T) {
+	exprs := []string{
+		"some(where (p_eft == allow))",
+		"!some(where (p_eft == deny))",
+		"some(where (p_eft == allow)) && !some(where (p_eft == deny))",
+		"priority(p_eft) || deny",
+		"deny-overrides",
+		"permit-overrides",
+		"first-applicable",
+		"only-one-applicable",
+		"deny-unless-permit",
+		"permit-unless-deny",
+		"allow",
+		"!some(where (p_eft == deny)) || some(where (p_eft == allow))",
+		"(deny-overrides || allow) && !priority(p_eft)",
+	}
+
+	// All the sequences of 4 effects.
+	var sequences [][]Effect
+	var generate func(prefix []Effect)
+	generate = func(prefix []Effect) {
+		if len(prefix) == 4 {
+			sequences = append(sequences, prefix)
+			return
+		}
+		for _, eft := range []Effect{Allow, Indeterminate, Deny} {
+			generate(append(append([]Effect{}, prefix...), eft))
+		}
+	}
+	generate(nil)
+
+	for _, expr := range exprs {
+		e, err := Compile(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, effects := range sequences {
+			res, index := e.Evaluate(effects)
+
+			d := e.NewDecision()
+			for i, eft := range effects {
+				if eft == Indeterminate || !d.Add(i, eft) {
+					continue
+				}
+				partialRes, partialIndex := e.Evaluate(effects[:i+1])
+				if partialRes != res || partialIndex != index {
+					t.Errorf("%s, %v: decided after %d effects as %t, %d, supposed to be %t, %d",
+						expr, effects, i+1, partialRes, partialIndex, res, index)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestSubjectPriority(t *testing.T) {
+	e, err := Compile("subjectPriority(p_eft) || deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.HasSubjectPriority() {
+		t.Error("the expression should use subject priority")
+	}
+	if res, index := e.Evaluate([]Effect{Indeterminate, Deny, Allow}); res || index != 1 {
+		t.Errorf("%t, %d, supposed to be false, 1", res, index)
+	}
+	// The effects are ordered after all the rules are evaluated.
+	if d := e.NewDecision(); d.Add(0, Allow) {
+		t.Error("the first matching rule should not decide the result")
+	}
+
+	if e, _ := Compile("priority(p_eft) || deny"); e.HasSubjectPriority() {
+		t.Error("the expression should not use subject priority")
+	}
+}
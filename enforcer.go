@@ -15,9 +15,12 @@
 package casbin
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 
 	"github.com/Knetic/govaluate"
 	"github.com/casbin/casbin/v2/effect"
@@ -39,7 +42,20 @@ type Enforcer struct {
 
 	adapter persist.Adapter
 	watcher persist.Watcher
-	rm      rbac.RoleManager
+	rmMap   map[string]rbac.RoleManager
+
+	matchers *matcherCache
+	// The compiled policy effects of the model by type, the ones the effects package does not know are missing.
+	effects          map[string]*effect.Expression
+	contextFunctions map[string]bool
+	// The error of the matchers calling functions that are not added yet.
+	functionErr  error
+	policyIndex  *policyIndex
+	batchWorkers int
+
+	policyChangeHandlers []func(evt PolicyEvent)
+	// The sequence number of the last message of every sender received by the watcher.
+	watcherSeqs map[string]uint64
 
 	enabled            bool
 	autoSave           bool
@@ -50,13 +66,16 @@ type Enforcer struct {
 //
 // File:
 //
-// 	e := casbin.NewEnforcer("path/to/basic_model.conf", "path/to/basic_policy.csv")
+//	e := casbin.NewEnforcer("path/to/basic_model.conf", "path/to/basic_policy.csv")
 //
-// MySQL DB:
+// Predefined model:
 //
-// 	a := mysqladapter.NewDBAdapter("mysql", "mysql_username:mysql_password@tcp(127.0.0.1:3306)/")
-// 	e := casbin.NewEnforcer("path/to/basic_model.conf", a)
+//	e := casbin.NewEnforcer("rbac", "path/to/rbac_policy.csv")
 //
+// MySQL DB:
+//
+//	a := mysqladapter.NewDBAdapter("mysql", "mysql_username:mysql_password@tcp(127.0.0.1:3306)/")
+//	e := casbin.NewEnforcer("path/to/basic_model.conf", a)
 func NewEnforcer(params ...interface{}) (*Enforcer, error) {
 	e := &Enforcer{}
 
@@ -126,8 +145,10 @@ func (e *Enforcer) InitWithFile(modelPath string, policyPath string) error {
 }
 
 // InitWithAdapter initializes an enforcer with a database adapter.
+// modelPath may also be the name of a predefined model like "rbac", see model.Predefined(),
+// it is used when there is no file at modelPath.
 func (e *Enforcer) InitWithAdapter(modelPath string, adapter persist.Adapter) error {
-	m, err := model.NewModelFromFile(modelPath)
+	m, err := newModelFromPath(modelPath)
 	if err != nil {
 		return err
 	}
@@ -148,9 +169,14 @@ func (e *Enforcer) InitWithModelAndAdapter(m model.Model, adapter persist.Adapte
 	e.model = m
 	e.model.PrintModel()
 	e.fm = model.LoadFunctionMap()
+	e.contextFunctions = nil
 
 	e.initialize()
 
+	if err := e.validateModel(); err != nil {
+		return err
+	}
+
 	// Do not initialize the full policy when using a filtered adapter
 	fa, ok := e.adapter.(persist.FilteredAdapter)
 	if e.adapter != nil && (!ok || ok && !fa.IsFiltered()) {
@@ -164,43 +190,96 @@ func (e *Enforcer) InitWithModelAndAdapter(m model.Model, adapter persist.Adapte
 }
 
 func (e *Enforcer) initialize() {
-	e.rm = defaultrolemanager.NewRoleManager(10)
+	e.initRmMap()
 	e.eft = effect.NewDefaultEffector()
 	e.watcher = nil
+	e.matchers = newMatcherCache()
+	e.policyIndex = newPolicyIndex()
 
 	e.enabled = true
 	e.autoSave = true
 	e.autoBuildRoleLinks = true
 }
 
+// initRmMap creates a role manager for every grouping type of the model.
+// The "g" role manager always exists, even if the model defines no roles.
+func (e *Enforcer) initRmMap() {
+	e.rmMap = map[string]rbac.RoleManager{}
+	e.rmMap["g"] = defaultrolemanager.NewRoleManager(10)
+	for ptype := range e.model["g"] {
+		if _, ok := e.rmMap[ptype]; !ok {
+			e.rmMap[ptype] = defaultrolemanager.NewRoleManager(10)
+		}
+	}
+}
+
+// newModelFromPath loads the model from the CONF file at path, or the predefined model named path
+// if there is no such file.
+func newModelFromPath(path string) (model.Model, error) {
+	if fi, err := os.Stat(path); (err != nil || fi.IsDir()) && model.IsPredefined(path) {
+		return model.Predefined(path)
+	}
+	return model.NewModelFromFile(path)
+}
+
 // LoadModel reloads the model from the model CONF file.
 // Because the policy is attached to a model, so the policy is invalidated and needs to be reloaded by calling LoadPolicy().
 func (e *Enforcer) LoadModel() error {
 	var err error
-	e.model, err = model.NewModelFromFile(e.modelPath)
+	e.model, err = newModelFromPath(e.modelPath)
 	if err != nil {
 		return err
 	}
 
 	e.model.PrintModel()
 	e.fm = model.LoadFunctionMap()
+	e.contextFunctions = nil
 
 	e.initialize()
 
+	return e.validateModel()
+}
+
+// validateModel reports the mistakes of the model when it is loaded instead of at the first enforcement.
+// The custom functions are usually added after the model is loaded, so the calls of undefined functions
+// are checked again by AddFunction() and reported by the enforcement. Custom effectors may support other expressions,
+// so only the policy effects of the default effector are compiled.
+func (e *Enforcer) validateModel() error {
+	if err := e.model.Validate(nil); err != nil {
+		return err
+	}
+	e.validateFunctions()
+
+	e.effects = make(map[string]*effect.Expression, len(e.model["e"]))
+	_, isDefault := e.eft.(*effect.DefaultEffector)
+	for key, ast := range e.model["e"] {
+		expression, err := effect.Compile(ast.Value)
+		if err != nil {
+			if isDefault {
+				return err
+			}
+			continue
+		}
+		e.effects[key] = expression
+	}
 	return nil
 }
 
-// GetModel gets the current model.
+// GetModel gets the current model. The rules of its policies are changed with the methods of the model,
+// a policy changed directly must be indexed again with IndexPolicies().
 func (e *Enforcer) GetModel() model.Model {
 	return e.model
 }
 
 // SetModel sets the current model.
-func (e *Enforcer) SetModel(m model.Model) {
+func (e *Enforcer) SetModel(m model.Model) error {
 	e.model = m
 	e.fm = model.LoadFunctionMap()
+	e.contextFunctions = nil
 
 	e.initialize()
+
+	return e.validateModel()
 }
 
 // GetAdapter gets the current adapter.
@@ -216,17 +295,29 @@ func (e *Enforcer) SetAdapter(adapter persist.Adapter) {
 // SetWatcher sets the current watcher.
 func (e *Enforcer) SetWatcher(watcher persist.Watcher) error {
 	e.watcher = watcher
-	return watcher.SetUpdateCallback(func(string) { e.LoadPolicy() })
+	e.watcherSeqs = nil
+	return watcher.SetUpdateCallback(func(msg string) { _ = e.onWatcherUpdate(msg) })
 }
 
 // GetRoleManager gets the current role manager.
 func (e *Enforcer) GetRoleManager() rbac.RoleManager {
-	return e.rm
+	return e.GetNamedRoleManager("g")
 }
 
 // SetRoleManager sets the current role manager.
 func (e *Enforcer) SetRoleManager(rm rbac.RoleManager) {
-	e.rm = rm
+	e.SetNamedRoleManager("g", rm)
+}
+
+// GetNamedRoleManager gets the role manager for the named grouping type, like "g2".
+func (e *Enforcer) GetNamedRoleManager(ptype string) rbac.RoleManager {
+	return e.rmMap[ptype]
+}
+
+// SetNamedRoleManager sets the role manager for the named grouping type, like "g2".
+func (e *Enforcer) SetNamedRoleManager(ptype string, rm rbac.RoleManager) {
+	e.rmMap[ptype] = rm
+	e.invalidateMatcherCache()
 }
 
 // SetEffector sets the current effector.
@@ -236,30 +327,25 @@ func (e *Enforcer) SetEffector(eft effect.Effector) {
 
 // ClearPolicy clears all policy.
 func (e *Enforcer) ClearPolicy() {
+	// The cleared rules are captured before the clear, the handlers are called after it.
+	events := e.policyChangeAll(PolicyClear, PolicySourceAPI)
 	e.model.ClearPolicy()
+	for _, evt := range events {
+		e.notifyPolicyChange(evt)
+	}
 }
 
 // LoadPolicy reloads the policy from file/database.
 func (e *Enforcer) LoadPolicy() error {
-	e.model.ClearPolicy()
-	if err := e.adapter.LoadPolicy(e.model); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
-		return err
-	}
+	return e.loadPolicy(PolicySourceLoadPolicy)
+}
 
-	e.model.PrintPolicy()
-	if e.autoBuildRoleLinks {
-		err := e.BuildRoleLinks()
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (e *Enforcer) loadPolicy(source PolicySource) error {
+	return e.loadPolicyWith(e.adapter.LoadPolicy, source)
 }
 
 // LoadFilteredPolicy reloads a filtered policy from file/database.
 func (e *Enforcer) LoadFilteredPolicy(filter interface{}) error {
-	e.model.ClearPolicy()
-
 	var filteredAdapter persist.FilteredAdapter
 
 	// Attempt to cast the Adapter as a FilteredAdapter
@@ -269,9 +355,26 @@ func (e *Enforcer) LoadFilteredPolicy(filter interface{}) error {
 	default:
 		return errors.New("filtered policies are not supported by this adapter")
 	}
-	if err := filteredAdapter.LoadFilteredPolicy(e.model, filter); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
+	return e.loadPolicyWith(func(m model.Model) error {
+		return filteredAdapter.LoadFilteredPolicy(m, filter)
+	}, PolicySourceLoadPolicy)
+}
+
+// loadPolicyWith loads the policy into a copy of the model and replaces the rules of the model
+// once it is loaded and sorted, so the previous policy is kept when loading fails.
+func (e *Enforcer) loadPolicyWith(load func(m model.Model) error, source PolicySource) error {
+	m := e.model.CopyDefinitions()
+	if err := load(m); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
 		return err
 	}
+	if err := m.SortPoliciesByPriority(); err != nil {
+		return err
+	}
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			e.model.SetPolicy(sec, ptype, ast.Policy)
+		}
+	}
 
 	e.model.PrintPolicy()
 	if e.autoBuildRoleLinks {
@@ -280,6 +383,7 @@ func (e *Enforcer) LoadFilteredPolicy(filter interface{}) error {
 			return err
 		}
 	}
+	e.notifyPolicyChangeAll(PolicyLoad, source)
 	return nil
 }
 
@@ -300,7 +404,9 @@ func (e *Enforcer) SavePolicy() error {
 	if err := e.adapter.SavePolicy(e.model); err != nil {
 		return err
 	}
-	if e.watcher != nil {
+	if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+		return watcher.UpdateForSavePolicy(e.model)
+	} else if e.watcher != nil {
 		return e.watcher.Update()
 	}
 	return nil
@@ -328,18 +434,57 @@ func (e *Enforcer) EnableAutoBuildRoleLinks(autoBuildRoleLinks bool) {
 
 // BuildRoleLinks manually rebuild the role inheritance relations.
 func (e *Enforcer) BuildRoleLinks() error {
-	err := e.rm.Clear()
-	if err != nil {
-		return err
+	for ptype, ast := range e.model["g"] {
+		rm, ok := e.rmMap[ptype]
+		if !ok {
+			rm = defaultrolemanager.NewRoleManager(10)
+			e.rmMap[ptype] = rm
+		}
+
+		err := rm.Clear()
+		if err != nil {
+			return err
+		}
+
+		// The g() functions of compiled matchers are bound to the role managers of the assertions.
+		if ast.RM != rm {
+			e.invalidateMatcherCache()
+		}
 	}
 
-	return e.model.BuildRoleLinks(e.rm)
+	return e.model.BuildRoleLinks(e.rmMap)
 }
 
-// enforce use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
-func (e *Enforcer) enforce(matcher string, rvals ...interface{}) (bool, error) {
-	if !e.enabled {
-		return true, nil
+// validateFunctions checks the functions called by the matchers against the function map.
+// The custom functions are added after the model is loaded, so an undefined function is not
+// an error of the model: it is returned by the enforcement until the function is added.
+func (e *Enforcer) validateFunctions() {
+	e.functionErr = e.model.Validate(e.fm)
+}
+
+// invalidateMatcherCache drops all compiled matchers, it must be called whenever
+// the model, the function map or the role manager changes.
+func (e *Enforcer) invalidateMatcherCache() {
+	if e.matchers != nil {
+		e.matchers.clear()
+	}
+}
+
+// getCompiledMatcher returns the compiled form of the matcher selected by ec, or of matcher when it is not "".
+func (e *Enforcer) getCompiledMatcher(ec EnforceContext, matcher string) (*compiledMatcher, error) {
+	custom := matcher != ""
+	expString := matcher
+	if !custom {
+		expString = e.model["m"][ec.MType].Value
+	}
+
+	// The same expression yields different token indexes for different request and policy definitions.
+	cacheKey := ec.RType + "," + ec.PType + "," + expString
+	if cm, ok := e.matchers.get(cacheKey, custom); ok {
+		return cm, nil
+	}
+	if !custom && e.functionErr != nil {
+		return nil, e.functionErr
 	}
 
 	functions := model.FunctionMap{}
@@ -352,51 +497,199 @@ func (e *Enforcer) enforce(matcher string, rvals ...interface{}) (bool, error) {
 			functions[key] = util.GenerateGFunction(rm)
 		}
 	}
-	var expString string
-	if matcher == "" {
-		expString = e.model["m"]["m"].Value
-	} else {
-		expString = matcher
+	for name := range e.contextFunctions {
+		expString = addContextArgument(expString, name)
 	}
 	expression, err := govaluate.NewEvaluableExpressionWithFunctions(expString, functions)
 	if err != nil {
-		return false, err
+		// The model knows better what is wrong with the matcher.
+		if !custom {
+			if verr := e.model.Validate(functions); verr != nil {
+				return nil, verr
+			}
+		}
+		return nil, err
 	}
 
-	rTokens := make(map[string]int, len(e.model["r"]["r"].Tokens))
-	for i, token := range e.model["r"]["r"].Tokens {
+	rTokens := make(map[string]int, len(e.model["r"][ec.RType].Tokens))
+	for i, token := range e.model["r"][ec.RType].Tokens {
 		rTokens[token] = i
 	}
-	pTokens := make(map[string]int, len(e.model["p"]["p"].Tokens))
-	for i, token := range e.model["p"]["p"].Tokens {
+	pTokens := make(map[string]int, len(e.model["p"][ec.PType].Tokens))
+	for i, token := range e.model["p"][ec.PType].Tokens {
 		pTokens[token] = i
 	}
 
+	cm := &compiledMatcher{
+		expression:   expression,
+		rTokens:      rTokens,
+		pTokens:      pTokens,
+		indexClauses: getIndexClauses(expression.Tokens(), rTokens, pTokens),
+
+		subjectRoleType: getSubjectRoleType(expString, getSubjectToken(ec, e.model["r"][ec.RType].Tokens), e.model["g"]),
+	}
+	e.matchers.put(cacheKey, custom, cm)
+	return cm, nil
+}
+
+// EnforceContext selects the request, policy, effect and matcher definitions a request is evaluated against.
+// Pass it as the first request value to Enforce() and its variants.
+type EnforceContext struct {
+	RType string
+	PType string
+	EType string
+	MType string
+}
+
+// NewEnforceContext creates an EnforceContext selecting the definitions with the given suffix,
+// e.g. NewEnforceContext("2") selects r2, p2, e2 and m2.
+func NewEnforceContext(suffix string) EnforceContext {
+	return EnforceContext{
+		RType: "r" + suffix,
+		PType: "p" + suffix,
+		EType: "e" + suffix,
+		MType: "m" + suffix,
+	}
+}
+
+var defaultEnforceContext = NewEnforceContext("")
+
+// splitEnforceContext extracts the EnforceContext from the request values, if any.
+func splitEnforceContext(rvals []interface{}) (EnforceContext, []interface{}) {
+	if len(rvals) != 0 {
+		switch ec := rvals[0].(type) {
+		case EnforceContext:
+			return ec, rvals[1:]
+		case *EnforceContext:
+			return *ec, rvals[1:]
+		}
+	}
+	return defaultEnforceContext, rvals
+}
+
+// checkEnforceContext returns an error if a definition selected by ec does not exist in the model.
+func (e *Enforcer) checkEnforceContext(ec EnforceContext) error {
+	for _, def := range []struct{ sec, key string }{
+		{"r", ec.RType}, {"p", ec.PType}, {"e", ec.EType}, {"m", ec.MType},
+	} {
+		if _, ok := e.model[def.sec][def.key]; !ok {
+			return fmt.Errorf("%s is not defined in the model", def.key)
+		}
+	}
+	return nil
+}
+
+// enforce use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
+// The first request value may be an EnforceContext selecting the definitions to use.
+// When explain is not nil, it is filled with the policy rule that decided the result.
+// The evaluation stops with the error of ctx as soon as ctx is done.
+func (e *Enforcer) enforce(ctx context.Context, matcher string, explain *Explanation, rvals ...interface{}) (bool, error) {
+	ec, rvals := splitEnforceContext(rvals)
+	if err := e.checkEnforceContext(ec); err != nil {
+		return false, err
+	}
+
+	var cm *compiledMatcher
+	if e.enabled {
+		var err error
+		cm, err = e.getCompiledMatcher(ec, matcher)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return e.evaluate(ctx, ec, cm, explain, rvals)
+}
+
+// evaluate decides a request with an already compiled matcher, it only reads the enforcer state
+// and is safe to be called concurrently.
+func (e *Enforcer) evaluate(ctx context.Context, ec EnforceContext, cm *compiledMatcher, explain *Explanation, rvals []interface{}) (bool, error) {
+	rAst := e.model["r"][ec.RType]
+	pAst := e.model["p"][ec.PType]
+	effectExpr := e.model["e"][ec.EType].Value
+	// The default effector would compile the policy effect again for every request.
+	effectExpression := e.effects[ec.EType]
+	_, isDefault := e.eft.(*effect.DefaultEffector)
+	if !isDefault {
+		effectExpression = nil
+	}
+
+	if explain != nil {
+		explain.Effect = effectExpr
+		explain.PType = ec.PType
+		explain.Index = -1
+	}
+
+	if !e.enabled {
+		return true, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	done := ctx.Done()
+
+	expression := cm.expression
+
 	parameters := enforceParameters{
-		rTokens: rTokens,
+		ctx: ctx,
+
+		rTokens: cm.rTokens,
 		rVals:   rvals,
 
-		pTokens: pTokens,
+		pTokens: cm.pTokens,
 	}
 
 	var policyEffects []effect.Effect
 	var matcherResults []float64
-	if policyLen := len(e.model["p"]["p"].Policy); policyLen != 0 {
-		policyEffects = make([]effect.Effect, policyLen)
-		matcherResults = make([]float64, policyLen)
-		if len(e.model["r"]["r"].Tokens) != len(rvals) {
+	var candidates []int
+	if policyLen := len(pAst.Policy); policyLen != 0 {
+		if len(rAst.Tokens) != len(rvals) {
 			return false, fmt.Errorf(
 				"invalid request size: expected %d, got %d, rvals: %v",
-				len(e.model["r"]["r"].Tokens),
+				len(rAst.Tokens),
 				len(rvals),
 				rvals)
 		}
-		for i, pvals := range e.model["p"]["p"].Policy {
+
+		// Only the candidate rules from the policy index can match, the others are indeterminate.
+		var indexed bool
+		candidates, indexed = e.getCandidatePolicies(ec, cm, pAst, rvals)
+		if indexed {
+			policyLen = len(candidates)
+		}
+		policyEffects = make([]effect.Effect, policyLen)
+		matcherResults = make([]float64, policyLen)
+
+		// The effector may know the result before all the rules are evaluated.
+		var decision effect.Decision
+		if effectExpression != nil {
+			decision = effectExpression.NewDecision()
+		} else if decider, ok := e.eft.(effect.Decider); ok {
+			var err error
+			if decision, err = decider.NewDecision(effectExpr); err != nil {
+				return false, err
+			}
+		}
+
+		for i := range policyEffects {
+			if done != nil {
+				select {
+				case <-done:
+					return false, ctx.Err()
+				default:
+				}
+			}
+
+			pvals := pAst.Policy[i]
+			if indexed {
+				pvals = pAst.Policy[candidates[i]]
+			}
 			// log.LogPrint("Policy Rule: ", pvals)
-			if len(e.model["p"]["p"].Tokens) != len(pvals) {
+			if len(pAst.Tokens) != len(pvals) {
 				return false, fmt.Errorf(
 					"invalid policy size: expected %d, got %d, pvals: %v",
-					len(e.model["p"]["p"].Tokens),
+					len(pAst.Tokens),
 					len(pvals),
 					pvals)
 			}
@@ -427,7 +720,7 @@ func (e *Enforcer) enforce(matcher string, rvals ...interface{}) (bool, error) {
 				return false, errors.New("matcher result should be bool, int or float")
 			}
 
-			if j, ok := parameters.pTokens["p_eft"]; ok {
+			if j, ok := parameters.pTokens[ec.PType+"_eft"]; ok {
 				eft := parameters.pVals[j]
 				if eft == "allow" {
 					policyEffects[i] = effect.Allow
@@ -440,10 +733,11 @@ func (e *Enforcer) enforce(matcher string, rvals ...interface{}) (bool, error) {
 				policyEffects[i] = effect.Allow
 			}
 
-			if e.model["e"]["e"].Value == "priority(p_eft) || deny" {
+			if decision != nil && decision.Add(i, policyEffects[i]) {
+				policyEffects = policyEffects[:i+1]
+				matcherResults = matcherResults[:i+1]
 				break
 			}
-
 		}
 	} else {
 		policyEffects = make([]effect.Effect, 1)
@@ -467,9 +761,32 @@ func (e *Enforcer) enforce(matcher string, rvals ...interface{}) (bool, error) {
 
 	// log.LogPrint("Rule Results: ", policyEffects)
 
-	result, err := e.eft.MergeEffects(e.model["e"]["e"].Value, policyEffects, matcherResults)
-	if err != nil {
-		return false, err
+	var order []int
+	if expression, ok := e.effects[ec.EType]; ok && expression.HasSubjectPriority() && len(pAst.Policy) != 0 {
+		order = e.sortBySubjectPriority(ec, cm, rvals, pAst.Policy, candidates, policyEffects, matcherResults)
+	}
+
+	var result bool
+	var explainIndex int
+	if effectExpression != nil {
+		result, explainIndex = effectExpression.Evaluate(policyEffects)
+	} else {
+		var err error
+		result, explainIndex, err = e.eft.MergeEffects(effectExpr, policyEffects, matcherResults)
+		if err != nil {
+			return false, err
+		}
+	}
+	if order != nil && explainIndex != -1 {
+		explainIndex = order[explainIndex]
+	}
+	if candidates != nil && explainIndex != -1 {
+		explainIndex = candidates[explainIndex]
+	}
+
+	if explain != nil && explainIndex != -1 && len(pAst.Policy) > explainIndex {
+		explain.Index = explainIndex
+		explain.Rule = pAst.Policy[explainIndex]
 	}
 
 	// Log request.
@@ -492,16 +809,194 @@ func (e *Enforcer) enforce(matcher string, rvals ...interface{}) (bool, error) {
 
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 func (e *Enforcer) Enforce(rvals ...interface{}) (bool, error) {
-	return e.enforce("", rvals...)
+	return e.enforce(context.Background(), "", nil, rvals...)
 }
 
 // EnforceWithMatcher use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
 func (e *Enforcer) EnforceWithMatcher(matcher string, rvals ...interface{}) (bool, error) {
-	return e.enforce(matcher, rvals...)
+	return e.enforce(context.Background(), matcher, nil, rvals...)
+}
+
+// EnforceCtx decides whether a "subject" can access a "object" with the operation "action" like Enforce(),
+// the evaluation stops when ctx is cancelled or its deadline is exceeded, and ctx is passed to the
+// functions added with AddContextFunction().
+func (e *Enforcer) EnforceCtx(ctx context.Context, rvals ...interface{}) (bool, error) {
+	return e.enforce(ctx, "", nil, rvals...)
+}
+
+// EnforceWithMatcherCtx use a custom matcher to decides whether a "subject" can access a "object" with the operation "action" like EnforceCtx().
+func (e *Enforcer) EnforceWithMatcherCtx(ctx context.Context, matcher string, rvals ...interface{}) (bool, error) {
+	return e.enforce(ctx, matcher, nil, rvals...)
+}
+
+// EnforceEx explains enforcement by returning the policy rule that decided the result besides the result itself.
+func (e *Enforcer) EnforceEx(rvals ...interface{}) (bool, *Explanation, error) {
+	explain := &Explanation{}
+	res, err := e.enforce(context.Background(), "", explain, rvals...)
+	return res, explain, err
+}
+
+// EnforceExWithMatcher use a custom matcher and explains enforcement by returning the policy rule that decided the result.
+func (e *Enforcer) EnforceExWithMatcher(matcher string, rvals ...interface{}) (bool, *Explanation, error) {
+	explain := &Explanation{}
+	res, err := e.enforce(context.Background(), matcher, explain, rvals...)
+	return res, explain, err
+}
+
+// getCandidatePolicies returns the positions of the rules that can match the request according to the
+// policy index, it returns false when the matcher cannot be answered from the index.
+func (e *Enforcer) getCandidatePolicies(ec EnforceContext, cm *compiledMatcher, pAst *model.Assertion, rvals []interface{}) ([]int, bool) {
+	var res []int
+	indexed := false
+	for _, clause := range cm.indexClauses {
+		value, ok := rvals[clause.rIndex].(string)
+		if !ok {
+			continue
+		}
+
+		candidates := e.policyIndex.candidates(ec.PType, pAst, clause.pField, value)
+		if !indexed || len(candidates) < len(res) {
+			res = candidates
+			indexed = true
+		}
+	}
+
+	if indexed && res == nil {
+		res = []int{}
+	}
+	return res, indexed
+}
+
+// BatchEnforce enforces each request and returns the results in the same order.
+// The matchers are compiled once for the whole batch, and the requests are evaluated
+// in parallel when SetBatchEnforceWorkers() allows more than one worker.
+func (e *Enforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	results := make([]bool, len(requests))
+	if len(requests) == 0 {
+		return results, nil
+	}
+
+	contexts := make([]EnforceContext, len(requests))
+	rvals := make([][]interface{}, len(requests))
+	matchers := map[EnforceContext]*compiledMatcher{}
+	for i, request := range requests {
+		contexts[i], rvals[i] = splitEnforceContext(request)
+		if _, ok := matchers[contexts[i]]; ok {
+			continue
+		}
+		if err := e.checkEnforceContext(contexts[i]); err != nil {
+			return nil, err
+		}
+
+		var cm *compiledMatcher
+		if e.enabled {
+			var err error
+			cm, err = e.getCompiledMatcher(contexts[i], "")
+			if err != nil {
+				return nil, err
+			}
+		}
+		matchers[contexts[i]] = cm
+	}
+
+	workers := e.batchWorkers
+	if workers > len(requests) {
+		workers = len(requests)
+	}
+	if workers <= 1 {
+		for i := range requests {
+			res, err := e.evaluate(context.Background(), contexts[i], matchers[contexts[i]], nil, rvals[i])
+			if err != nil {
+				return nil, err
+			}
+			results[i] = res
+		}
+		return results, nil
+	}
+
+	errs := make([]error, len(requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = e.evaluate(context.Background(), contexts[i], matchers[contexts[i]], nil, rvals[i])
+			}
+		}()
+	}
+	for i := range requests {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// SetBatchEnforceWorkers sets the number of goroutines BatchEnforce() evaluates requests with,
+// a value less than or equal to 1 evaluates them sequentially, which is the default.
+func (e *Enforcer) SetBatchEnforceWorkers(workers int) {
+	e.batchWorkers = workers
+}
+
+// Explanation describes the policy rule that decided an enforcement result.
+// Index is -1 and Rule is nil when no single rule decided the result,
+// e.g. when nothing matched and the effect fell back to its default.
+type Explanation struct {
+	// Effect is the policy effect expression used to merge the matching results.
+	Effect string
+	// PType is the policy type the deciding rule belongs to, like "p".
+	PType string
+	// Index is the position of the deciding rule in the policy of PType.
+	Index int
+	// Rule is the deciding policy rule.
+	Rule []string
+}
+
+// contextParameter is the parameter the context of the enforcement is passed to the context functions in.
+const contextParameter = "casbin_context"
+
+// addContextArgument rewrites the calls of the context function name in the matcher so that
+// the context of the enforcement is passed as their first argument. The strings of the matcher
+// are left as they are.
+func addContextArgument(matcher string, name string) string {
+	calls, err := model.GetCalls(matcher)
+	if err != nil {
+		// The matcher does not compile, the error is reported by the compilation.
+		return matcher
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, call := range calls {
+		if call.Name != name {
+			continue
+		}
+		b.WriteString(matcher[last : call.Open+1])
+		b.WriteString(contextParameter)
+		last = call.Open + 1
+		if call.Arguments == 0 {
+			// Only spaces may come before the closing parenthesis.
+			last += strings.IndexByte(matcher[last:], ')')
+		} else {
+			b.WriteString(", ")
+		}
+	}
+	b.WriteString(matcher[last:])
+	return b.String()
 }
 
 // assumes bounds have already been checked
 type enforceParameters struct {
+	ctx context.Context
+
 	rTokens map[string]int
 	rVals   []interface{}
 
@@ -515,6 +1010,10 @@ func (p enforceParameters) Get(name string) (interface{}, error) {
 		return nil, nil
 	}
 
+	if name == contextParameter {
+		return p.ctx, nil
+	}
+
 	switch name[0] {
 	case 'p':
 		i, ok := p.pTokens[name]
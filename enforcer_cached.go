@@ -15,6 +15,7 @@
 package casbin
 
 import (
+	"context"
 	"strings"
 	"sync"
 )
@@ -54,17 +55,12 @@ func (e *CachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 		return e.Enforcer.Enforce(rvals...)
 	}
 
-	var key strings.Builder
-	for _, rval := range rvals {
-		if val, ok := rval.(string); ok {
-			key.WriteString(val)
-			key.WriteString("$$")
-		} else {
-			return e.Enforcer.Enforce(rvals...)
-		}
+	key, ok := getCacheKey(rvals...)
+	if !ok {
+		return e.Enforcer.Enforce(rvals...)
 	}
 
-	if res, ok := e.getCachedResult(key.String()); ok {
+	if res, ok := e.getCachedResult(key); ok {
 		return res, nil
 	}
 	res, err := e.Enforcer.Enforce(rvals...)
@@ -72,10 +68,107 @@ func (e *CachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 		return false, err
 	}
 
-	e.setCachedResult(key.String(), res)
+	e.setCachedResult(key, res)
+	return res, nil
+}
+
+// EnforceCtx decides whether a "subject" can access a "object" with the operation "action" like EnforceCtx() of Enforcer.
+// The result of a cancelled enforcement is not cached, and the cache is bypassed when context functions are added,
+// as their results depend on the context.
+func (e *CachedEnforcer) EnforceCtx(ctx context.Context, rvals ...interface{}) (bool, error) {
+	if !e.enableCache || len(e.contextFunctions) != 0 {
+		return e.Enforcer.EnforceCtx(ctx, rvals...)
+	}
+
+	key, ok := getCacheKey(rvals...)
+	if !ok {
+		return e.Enforcer.EnforceCtx(ctx, rvals...)
+	}
+
+	if res, ok := e.getCachedResult(key); ok {
+		return res, nil
+	}
+	res, err := e.Enforcer.EnforceCtx(ctx, rvals...)
+	if err != nil {
+		return false, err
+	}
+
+	e.setCachedResult(key, res)
 	return res, nil
 }
 
+// EnforceEx explains enforcement by returning the policy rule that decided the result besides the result itself.
+// An explanation can only be produced by evaluating the policy, so the cache is bypassed, but the decision is
+// stored so that following Enforce() calls agree with it.
+func (e *CachedEnforcer) EnforceEx(rvals ...interface{}) (bool, *Explanation, error) {
+	res, explain, err := e.Enforcer.EnforceEx(rvals...)
+	if err != nil || !e.enableCache {
+		return res, explain, err
+	}
+
+	if key, ok := getCacheKey(rvals...); ok {
+		e.setCachedResult(key, res)
+	}
+	return res, explain, nil
+}
+
+// BatchEnforce enforces each request and returns the results in the same order.
+// Cached decisions are reused, and only the remaining requests are evaluated.
+func (e *CachedEnforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	if !e.enableCache {
+		return e.Enforcer.BatchEnforce(requests)
+	}
+
+	results := make([]bool, len(requests))
+	keys := make([]string, len(requests))
+	var missed []int
+	var missedRequests [][]interface{}
+	for i, request := range requests {
+		key, ok := getCacheKey(request...)
+		if ok {
+			if res, ok := e.getCachedResult(key); ok {
+				results[i] = res
+				continue
+			}
+			keys[i] = key
+		}
+		missed = append(missed, i)
+		missedRequests = append(missedRequests, request)
+	}
+
+	if len(missed) == 0 {
+		return results, nil
+	}
+
+	missedResults, err := e.Enforcer.BatchEnforce(missedRequests)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range missed {
+		results[i] = missedResults[j]
+		if keys[i] != "" {
+			e.setCachedResult(keys[i], missedResults[j])
+		}
+	}
+	return results, nil
+}
+
+func getCacheKey(rvals ...interface{}) (string, bool) {
+	var key strings.Builder
+	for i, rval := range rvals {
+		if ctx, ok := rval.(EnforceContext); ok && i == 0 {
+			key.WriteString(ctx.RType + "," + ctx.PType + "," + ctx.EType + "," + ctx.MType)
+			key.WriteString("$$")
+		} else if val, ok := rval.(string); ok {
+			key.WriteString(val)
+			key.WriteString("$$")
+		} else {
+			return "", false
+		}
+	}
+	return key.String(), true
+}
+
 func (e *CachedEnforcer) getCachedResult(key string) (res bool, ok bool) {
 	e.locker.RLock()
 	defer e.locker.RUnlock()
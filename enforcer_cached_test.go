@@ -50,3 +50,26 @@ func TestCache(t *testing.T) {
 	testEnforceCache(t, e, "alice", "data2", "read", false)
 	testEnforceCache(t, e, "alice", "data2", "write", false)
 }
+
+func TestCacheBatchEnforce(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	results, _ := e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	if !results[0] || !results[1] {
+		t.Errorf("unexpected results: %v", results)
+	}
+
+	// The decisions are cached, so removing the rule does not change them until the cache is invalidated.
+	e.RemovePolicy("alice", "data1", "read")
+	results, _ = e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"alice", "data1", "write"}})
+	if !results[0] || results[1] {
+		t.Errorf("unexpected results: %v", results)
+	}
+	testEnforceCache(t, e, "alice", "data1", "write", false)
+
+	e.InvalidateCache()
+	results, _ = e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}})
+	if results[0] {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
@@ -28,7 +28,7 @@ type IEnforcer interface {
 	InitWithModelAndAdapter(m model.Model, adapter persist.Adapter)
 	LoadModel()
 	GetModel() model.Model
-	SetModel(m model.Model)
+	SetModel(m model.Model) error
 	GetAdapter() persist.Adapter
 	SetAdapter(adapter persist.Adapter)
 	SetWatcher(watcher persist.Watcher)
@@ -15,15 +15,21 @@
 package casbin
 
 import (
+	"context"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
 )
 
-// SyncedEnforcer wraps Enforcer and provides synchronized access
+// SyncedEnforcer wraps Enforcer and provides synchronized access.
+// The methods changing the model, the policy, the role links or the functions take the write lock.
+// The enforcement methods only read them and take the read lock like the other read-only methods,
+// so the requests are enforced concurrently: the compiled matchers and the policy indexes built
+// while enforcing have their own locks.
 type SyncedEnforcer struct {
 	*Enforcer
 	m        sync.RWMutex
@@ -73,7 +79,12 @@ func (e *SyncedEnforcer) StopAutoLoadPolicy() {
 // SetWatcher sets the current watcher.
 func (e *SyncedEnforcer) SetWatcher(watcher persist.Watcher) error {
 	e.watcher = watcher
-	return watcher.SetUpdateCallback(func(string) { e.LoadPolicy() })
+	e.watcherSeqs = nil
+	return watcher.SetUpdateCallback(func(msg string) {
+		e.m.Lock()
+		defer e.m.Unlock()
+		_ = e.Enforcer.onWatcherUpdate(msg)
+	})
 }
 
 // ClearPolicy clears all policy.
@@ -99,18 +110,61 @@ func (e *SyncedEnforcer) SavePolicy() error {
 
 // BuildRoleLinks manually rebuild the role inheritance relations.
 func (e *SyncedEnforcer) BuildRoleLinks() error {
-	e.m.RLock()
-	defer e.m.RUnlock()
+	e.m.Lock()
+	defer e.m.Unlock()
 	return e.Enforcer.BuildRoleLinks()
 }
 
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 func (e *SyncedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
-	e.m.Lock()
-	defer e.m.Unlock()
+	e.m.RLock()
+	defer e.m.RUnlock()
 	return e.Enforcer.Enforce(rvals...)
 }
 
+// EnforceWithMatcher use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
+func (e *SyncedEnforcer) EnforceWithMatcher(matcher string, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithMatcher(matcher, rvals...)
+}
+
+// EnforceEx explains enforcement by returning the policy rule that decided the result besides the result itself.
+func (e *SyncedEnforcer) EnforceEx(rvals ...interface{}) (bool, *Explanation, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceEx(rvals...)
+}
+
+// EnforceExWithMatcher use a custom matcher and explains enforcement by returning the policy rule that decided the result.
+func (e *SyncedEnforcer) EnforceExWithMatcher(matcher string, rvals ...interface{}) (bool, *Explanation, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceExWithMatcher(matcher, rvals...)
+}
+
+// EnforceCtx decides whether a "subject" can access a "object" with the operation "action" like EnforceCtx() of Enforcer.
+func (e *SyncedEnforcer) EnforceCtx(ctx context.Context, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceCtx(ctx, rvals...)
+}
+
+// EnforceWithMatcherCtx use a custom matcher to decides whether a "subject" can access a "object" with the operation "action" like EnforceCtx().
+func (e *SyncedEnforcer) EnforceWithMatcherCtx(ctx context.Context, matcher string, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithMatcherCtx(ctx, matcher, rvals...)
+}
+
+// BatchEnforce enforces each request and returns the results in the same order, the whole batch is
+// evaluated under a single read lock.
+func (e *SyncedEnforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.BatchEnforce(requests)
+}
+
 // GetAllSubjects gets the list of subjects that show up in the current policy.
 func (e *SyncedEnforcer) GetAllSubjects() []string {
 	e.m.RLock()
@@ -255,6 +309,24 @@ func (e *SyncedEnforcer) AddNamedPolicy(ptype string, params ...interface{}) (bo
 	return e.Enforcer.AddNamedPolicy(ptype, params...)
 }
 
+// AddPolicies adds authorization rules to the current policy.
+// If one of the rules already exists, the function returns false and none of the rules is added.
+// Otherwise the function returns true by adding the new rules.
+func (e *SyncedEnforcer) AddPolicies(rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddPolicies(rules)
+}
+
+// AddNamedPolicies adds authorization rules to the current named policy.
+// If one of the rules already exists, the function returns false and none of the rules is added.
+// Otherwise the function returns true by adding the new rules.
+func (e *SyncedEnforcer) AddNamedPolicies(ptype string, rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddNamedPolicies(ptype, rules)
+}
+
 // RemovePolicy removes an authorization rule from the current policy.
 func (e *SyncedEnforcer) RemovePolicy(params ...interface{}) (bool, error) {
 	e.m.Lock()
@@ -276,6 +348,56 @@ func (e *SyncedEnforcer) RemoveNamedPolicy(ptype string, params ...interface{})
 	return e.Enforcer.RemoveNamedPolicy(ptype, params...)
 }
 
+// RemovePolicies removes authorization rules from the current policy.
+// If one of the rules does not exist, the function returns false and none of the rules is removed.
+func (e *SyncedEnforcer) RemovePolicies(rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemovePolicies(rules)
+}
+
+// RemoveNamedPolicies removes authorization rules from the current named policy.
+// If one of the rules does not exist, the function returns false and none of the rules is removed.
+func (e *SyncedEnforcer) RemoveNamedPolicies(ptype string, rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemoveNamedPolicies(ptype, rules)
+}
+
+// UpdatePolicy replaces an authorization rule of the current policy.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (e *SyncedEnforcer) UpdatePolicy(oldRule []string, newRule []string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.UpdatePolicy(oldRule, newRule)
+}
+
+// UpdateNamedPolicy replaces an authorization rule of the current named policy.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (e *SyncedEnforcer) UpdateNamedPolicy(ptype string, oldRule []string, newRule []string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.UpdateNamedPolicy(ptype, oldRule, newRule)
+}
+
+// UpdatePolicies replaces authorization rules of the current policy, oldRules[i] is replaced by newRules[i].
+// If one of the old rules does not exist or one of the new rules already exists, the function returns false
+// and none of the rules is replaced.
+func (e *SyncedEnforcer) UpdatePolicies(oldRules [][]string, newRules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.UpdatePolicies(oldRules, newRules)
+}
+
+// UpdateNamedPolicies replaces authorization rules of the current named policy, oldRules[i] is replaced by newRules[i].
+// If one of the old rules does not exist or one of the new rules already exists, the function returns false
+// and none of the rules is replaced.
+func (e *SyncedEnforcer) UpdateNamedPolicies(ptype string, oldRules [][]string, newRules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.UpdateNamedPolicies(ptype, oldRules, newRules)
+}
+
 // RemoveFilteredNamedPolicy removes an authorization rule from the current named policy, field filters can be specified.
 func (e *SyncedEnforcer) RemoveFilteredNamedPolicy(ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
 	e.m.Lock()
@@ -315,6 +437,24 @@ func (e *SyncedEnforcer) AddNamedGroupingPolicy(ptype string, params ...interfac
 	return e.Enforcer.AddNamedGroupingPolicy(ptype, params...)
 }
 
+// AddGroupingPolicies adds role inheritance rules to the current policy.
+// If one of the rules already exists, the function returns false and none of the rules is added.
+// Otherwise the function returns true by adding the new rules.
+func (e *SyncedEnforcer) AddGroupingPolicies(rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddGroupingPolicies(rules)
+}
+
+// AddNamedGroupingPolicies adds named role inheritance rules to the current policy.
+// If one of the rules already exists, the function returns false and none of the rules is added.
+// Otherwise the function returns true by adding the new rules.
+func (e *SyncedEnforcer) AddNamedGroupingPolicies(ptype string, rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddNamedGroupingPolicies(ptype, rules)
+}
+
 // RemoveGroupingPolicy removes a role inheritance rule from the current policy.
 func (e *SyncedEnforcer) RemoveGroupingPolicy(params ...interface{}) (bool, error) {
 	e.m.Lock()
@@ -336,6 +476,38 @@ func (e *SyncedEnforcer) RemoveNamedGroupingPolicy(ptype string, params ...inter
 	return e.Enforcer.RemoveNamedGroupingPolicy(ptype, params...)
 }
 
+// RemoveGroupingPolicies removes role inheritance rules from the current policy.
+// If one of the rules does not exist, the function returns false and none of the rules is removed.
+func (e *SyncedEnforcer) RemoveGroupingPolicies(rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemoveGroupingPolicies(rules)
+}
+
+// RemoveNamedGroupingPolicies removes role inheritance rules from the current named policy.
+// If one of the rules does not exist, the function returns false and none of the rules is removed.
+func (e *SyncedEnforcer) RemoveNamedGroupingPolicies(ptype string, rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemoveNamedGroupingPolicies(ptype, rules)
+}
+
+// UpdateGroupingPolicy replaces a role inheritance rule of the current policy.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (e *SyncedEnforcer) UpdateGroupingPolicy(oldRule []string, newRule []string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.UpdateGroupingPolicy(oldRule, newRule)
+}
+
+// UpdateNamedGroupingPolicy replaces a named role inheritance rule of the current policy.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (e *SyncedEnforcer) UpdateNamedGroupingPolicy(ptype string, oldRule []string, newRule []string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.UpdateNamedGroupingPolicy(ptype, oldRule, newRule)
+}
+
 // RemoveFilteredNamedGroupingPolicy removes a role inheritance rule from the current named policy, field filters can be specified.
 func (e *SyncedEnforcer) RemoveFilteredNamedGroupingPolicy(ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
 	e.m.Lock()
@@ -343,9 +515,32 @@ func (e *SyncedEnforcer) RemoveFilteredNamedGroupingPolicy(ptype string, fieldIn
 	return e.Enforcer.RemoveFilteredNamedGroupingPolicy(ptype, fieldIndex, fieldValues...)
 }
 
+// OnPolicyChange registers a handler called after every change of the policy.
+// The handlers are called while the enforcer is locked, so they must not call the enforcer.
+func (e *SyncedEnforcer) OnPolicyChange(handler func(evt PolicyEvent)) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.OnPolicyChange(handler)
+}
+
+// BeginTransaction starts a transaction, the changes staged in it are applied by Commit().
+// The enforcer is locked while the transaction is committed, so that no enforcement sees a part of the changes.
+func (e *SyncedEnforcer) BeginTransaction() *Transaction {
+	tx := e.Enforcer.BeginTransaction()
+	tx.locker = &e.m
+	return tx
+}
+
 // AddFunction adds a customized function.
 func (e *SyncedEnforcer) AddFunction(name string, function govaluate.ExpressionFunction) {
 	e.m.Lock()
 	defer e.m.Unlock()
 	e.Enforcer.AddFunction(name, function)
 }
+
+// AddContextFunction adds a customized function that receives the context of the enforcement.
+func (e *SyncedEnforcer) AddContextFunction(name string, function model.ContextFunction) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.AddContextFunction(name, function)
+}
@@ -15,6 +15,9 @@
 package casbin
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -43,3 +46,95 @@ func TestSync(t *testing.T) {
 	// Stop the reloading policy periodically.
 	e.StopAutoLoadPolicy()
 }
+
+func TestSyncBatchEnforce(t *testing.T) {
+	e, _ := NewSyncedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	e.SetBatchEnforceWorkers(2)
+
+	results, err := e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"alice", "data2", "read"}, {"bob", "data2", "write"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0] || results[1] || !results[2] {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
+
+func TestSyncEnforceExWithMatcher(t *testing.T) {
+	e, _ := NewSyncedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	// The policy is changed while the requests are enforced.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, _ = e.AddPolicy(fmt.Sprintf("user%d", i), "data1", "read")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		res, explain, err := e.EnforceExWithMatcher("r_sub == p_sub && r_obj == p_obj", "alice", "data1", "write")
+		if !res || err != nil || len(explain.Rule) == 0 || explain.Rule[0] != "alice" {
+			t.Fatalf("EnforceExWithMatcher: %t, %v, %v", res, explain, err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestSyncEnforceWithMatcherCtx(t *testing.T) {
+	e, _ := NewSyncedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, _ = e.AddPolicy(fmt.Sprintf("user%d", i), "data1", "read")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		res, err := e.EnforceWithMatcherCtx(context.Background(), "r_sub == p_sub && r_obj == p_obj", "bob", "data2", "read")
+		if !res || err != nil {
+			t.Fatalf("EnforceWithMatcherCtx: %t, %v", res, err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestSyncConcurrentEnforce(t *testing.T) {
+	e, _ := NewSyncedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	// The requests are enforced concurrently while the policy and the role links change.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, _ = e.AddPolicy(fmt.Sprintf("role%d", i), "data3", "read")
+			_, _ = e.AddGroupingPolicy(fmt.Sprintf("user%d", i), fmt.Sprintf("role%d", i))
+			_ = e.BuildRoleLinks()
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if res, err := e.Enforce("alice", "data2", "read"); !res || err != nil {
+					t.Errorf("Enforce: %t, %v", res, err)
+				}
+				if res, _, err := e.EnforceEx("bob", "data2", "write"); !res || err != nil {
+					t.Errorf("EnforceEx: %t, %v", res, err)
+				}
+				if res, err := e.EnforceWithMatcher("", "bob", "data1", "read"); res || err != nil {
+					t.Errorf("EnforceWithMatcher: %t, %v", res, err)
+				}
+				if _, err := e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"user1", "data3", "read"}}); err != nil {
+					t.Errorf("BatchEnforce: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	testEnforceSync(t, e, "user49", "data3", "read", true)
+}
@@ -15,11 +15,17 @@
 package casbin
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/casbin/casbin/v2/model"
 	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	defaultrolemanager "github.com/casbin/casbin/v2/rbac/default-role-manager"
+	"github.com/casbin/casbin/v2/util"
 )
 
 func TestKeyMatchModelInMemory(t *testing.T) {
@@ -419,3 +425,354 @@ func TestInitEmpty(t *testing.T) {
 
 	testEnforce(t, e, "alice", "/alice_data/resource1", "GET", true)
 }
+
+func testEnforceEx(t *testing.T, e *Enforcer, sub string, obj interface{}, act string, res bool, rule []string) {
+	t.Helper()
+	myRes, explain, err := e.EnforceEx(sub, obj, act)
+	if err != nil {
+		t.Errorf("Enforce Error: %s", err)
+		return
+	}
+	if myRes != res {
+		t.Errorf("%s, %v, %s: %t, supposed to be %t", sub, obj, act, myRes, res)
+	}
+	if !util.ArrayEquals(explain.Rule, rule) {
+		t.Errorf("%s, %v, %s: %v, supposed to be %v", sub, obj, act, explain.Rule, rule)
+	}
+	if rule == nil && explain.Index != -1 {
+		t.Errorf("%s, %v, %s: explain index %d, supposed to be -1", sub, obj, act, explain.Index)
+	}
+}
+
+func TestEnforceEx(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	testEnforceEx(t, e, "alice", "data1", "read", true, []string{"alice", "data1", "read"})
+	testEnforceEx(t, e, "alice", "data1", "write", false, nil)
+	testEnforceEx(t, e, "bob", "data2", "write", true, []string{"bob", "data2", "write"})
+
+	e, _ = NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+
+	testEnforceEx(t, e, "alice", "data1", "read", true, []string{"alice", "data1", "read", "allow"})
+	testEnforceEx(t, e, "alice", "data2", "read", true, []string{"data2_admin", "data2", "read", "allow"})
+	testEnforceEx(t, e, "alice", "data2", "write", false, []string{"alice", "data2", "write", "deny"})
+
+	e, _ = NewEnforcer("examples/priority_model.conf", "examples/priority_policy.csv")
+
+	testEnforceEx(t, e, "alice", "data1", "read", true, []string{"alice", "data1", "read", "allow"})
+	testEnforceEx(t, e, "alice", "data1", "write", false, []string{"data1_deny_group", "data1", "write", "deny"})
+	testEnforceEx(t, e, "bob", "data2", "read", true, []string{"data2_allow_group", "data2", "read", "allow"})
+	testEnforceEx(t, e, "bob", "data1", "read", false, nil)
+
+	_, explain, _ := e.EnforceEx("alice", "data1", "write")
+	if explain.Index != 2 || explain.PType != "p" || explain.Effect != "priority(p_eft) || deny" {
+		t.Errorf("unexpected explanation: %+v", explain)
+	}
+}
+
+func TestMatcherCacheInvalidation(t *testing.T) {
+	e, _ := NewEnforcer("examples/keymatch_custom_model.conf", "examples/keymatch2_policy.csv")
+
+	e.AddFunction("keyMatchCustom", func(args ...interface{}) (interface{}, error) {
+		return false, nil
+	})
+	testEnforce(t, e, "alice", "/alice_data2/myid/using/res_id", "GET", false)
+
+	// Replacing a function must not be hidden by the compiled matcher.
+	e.AddFunction("keyMatchCustom", CustomFunctionWrapper)
+	testEnforce(t, e, "alice", "/alice_data2/myid/using/res_id", "GET", true)
+
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	testEnforce(t, e, "alice", "data2", "read", true)
+
+	// Replacing the role manager must rebind the g() function.
+	e.SetRoleManager(defaultrolemanager.NewRoleManager(10))
+	e.BuildRoleLinks()
+	testEnforce(t, e, "alice", "data2", "read", true)
+	testEnforce(t, e, "bob", "data2", "read", false)
+	e.GetRoleManager().AddLink("bob", "data2_admin")
+	testEnforce(t, e, "bob", "data2", "read", true)
+}
+
+func TestCustomMatcherCacheBound(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	for i := 0; i < maxCustomMatchers+10; i++ {
+		matcher := fmt.Sprintf("r_sub == p_sub && r_obj == p_obj && r_act == p_act && %d == %d", i, i)
+		res, err := e.EnforceWithMatcher(matcher, "alice", "data1", "read")
+		if err != nil || !res {
+			t.Fatalf("custom matcher %d: %t, %v", i, res, err)
+		}
+	}
+
+	if len(e.matchers.custom) != maxCustomMatchers || len(e.matchers.customOrder) != maxCustomMatchers {
+		t.Errorf("custom matcher cache holds %d matchers, supposed to be at most %d", len(e.matchers.custom), maxCustomMatchers)
+	}
+}
+
+func TestEnforceWithMultipleDefinitions(t *testing.T) {
+	// e2 merges the effects of p2 with p2.eft.
+	e, err := NewEnforcer("examples/multiple_definitions_model.conf", "examples/multiple_definitions_policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testEnforce(t, e, "alice", "/orders/1", "GET", true)
+	testEnforce(t, e, "alice", "/orders/1", "DELETE", false)
+	testEnforce(t, e, "bob", "/orders/1", "DELETE", true)
+
+	ctx := NewEnforceContext("2")
+	testEnforceWithContext := func(sub, tenant, table, act string, res bool) {
+		t.Helper()
+		if myRes, err := e.Enforce(ctx, sub, tenant, table, act); err != nil || myRes != res {
+			t.Errorf("%s, %s, %s, %s: %t (%v), supposed to be %t", sub, tenant, table, act, myRes, err, res)
+		}
+	}
+	testEnforceWithContext("alice", "tenant1", "orders", "read", true)
+	testEnforceWithContext("alice", "tenant2", "orders", "read", false)
+	testEnforceWithContext("admin", "tenant1", "orders", "write", true)
+	// bob is an admin, but his own deny rule wins with e2.
+	testEnforceWithContext("bob", "tenant1", "orders", "write", false)
+
+	_, explain, _ := e.EnforceEx(ctx, "admin", "tenant1", "orders", "write")
+	if explain.PType != "p2" || !util.ArrayEquals(explain.Rule, []string{"admin", "tenant1", "orders", "write", "allow"}) {
+		t.Errorf("unexpected explanation: %+v", explain)
+	}
+
+	// The management API works on the second policy type.
+	if _, err := e.AddNamedPolicy("p2", "alice", "tenant2", "orders", "read", "allow"); err != nil {
+		t.Fatal(err)
+	}
+	testEnforceWithContext("alice", "tenant2", "orders", "read", true)
+
+	if _, err := e.Enforce(NewEnforceContext("3"), "alice", "tenant1", "orders", "read"); err == nil {
+		t.Error("an undefined enforce context should return an error")
+	}
+	if _, err := e.Enforce(ctx, "alice", "/orders/1", "GET"); err == nil {
+		t.Error("a request not matching r2 should return an error")
+	}
+}
+
+func TestBatchEnforce(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	requests := [][]interface{}{
+		{"alice", "data1", "read"},
+		{"alice", "data1", "write"},
+		{"alice", "data2", "read"},
+		{"alice", "data2", "write"},
+		{"bob", "data1", "read"},
+		{"bob", "data1", "write"},
+		{"bob", "data2", "read"},
+		{"bob", "data2", "write"},
+	}
+	expected := []bool{true, false, true, true, false, false, false, true}
+
+	for _, workers := range []int{0, 3, 100} {
+		e.SetBatchEnforceWorkers(workers)
+		results, err := e.BatchEnforce(requests)
+		if err != nil {
+			t.Fatalf("workers %d: %s", workers, err)
+		}
+		for i, res := range results {
+			if res != expected[i] {
+				t.Errorf("workers %d: %v: %t, supposed to be %t", workers, requests[i], res, expected[i])
+			}
+		}
+	}
+
+	e.SetBatchEnforceWorkers(4)
+	if _, err := e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"alice", "data1"}}); err == nil {
+		t.Error("an invalid request in the batch should return an error")
+	}
+}
+
+type tenantKey struct{}
+
+func TestEnforceCtx(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	res, err := e.EnforceCtx(context.Background(), "alice", "data1", "read")
+	if err != nil || !res {
+		t.Errorf("EnforceCtx: %t, %v, supposed to be true", res, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.EnforceCtx(ctx, "alice", "data1", "read"); !errors.Is(err, context.Canceled) {
+		t.Errorf("a cancelled context should return context.Canceled, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if _, err := e.EnforceCtx(ctx, "alice", "data1", "read"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("an expired context should return context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestEnforceCtxCancelDuringEvaluation(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	e.AddContextFunction("stop", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		calls++
+		cancel()
+		return false, nil
+	})
+	_ = e.GetModel().AddDef("m", "m", "stop() || r.sub == p.sub && r.obj == p.obj && r.act == p.act")
+
+	if _, err := e.EnforceCtx(ctx, "bob", "data2", "write"); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelling during the evaluation should return context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("the evaluation should stop after the first rule, %d rules were evaluated", calls)
+	}
+}
+
+func TestContextFunction(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+
+	e.AddContextFunction("tenantOf", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant, nil
+	})
+	e.AddContextFunction("inTenant", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		return ctx.Value(tenantKey{}) == args[0], nil
+	})
+	_ = e.GetModel().AddDef("m", "m", "g(r.sub, p.sub, tenantOf()) && inTenant(p.dom) && r.obj == p.obj && r.act == p.act")
+
+	ctx1 := context.WithValue(context.Background(), tenantKey{}, "domain1")
+	ctx2 := context.WithValue(context.Background(), tenantKey{}, "domain2")
+
+	testCases := []struct {
+		ctx context.Context
+		sub string
+		obj string
+		res bool
+	}{
+		{ctx1, "alice", "data1", true},
+		{ctx1, "alice", "data2", false},
+		{ctx2, "bob", "data2", true},
+		{ctx2, "alice", "data1", false},
+		{context.Background(), "alice", "data1", false},
+	}
+	for _, tc := range testCases {
+		// The domain of the request is ignored by the matcher, it is taken from the context.
+		res, err := e.EnforceCtx(tc.ctx, tc.sub, "ignored", tc.obj, "read")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != tc.res {
+			t.Errorf("%s, %s, %v: %t, supposed to be %t", tc.sub, tc.obj, tc.ctx.Value(tenantKey{}), res, tc.res)
+		}
+	}
+
+	// Enforce() passes a background context.
+	res, err := e.Enforce("alice", "domain1", "data1", "read")
+	if err != nil || res {
+		t.Errorf("Enforce: %t, %v, supposed to be false", res, err)
+	}
+}
+
+func TestAddContextArgument(t *testing.T) {
+	testCases := []struct {
+		matcher  string
+		expected string
+	}{
+		{"f()", "f(casbin_context)"},
+		{"f( ) && r.sub == p.sub", "f(casbin_context) && r.sub == p.sub"},
+		{"f(r.sub, p.sub)", "f(casbin_context, r.sub, p.sub)"},
+		{"f(f(r.sub))", "f(casbin_context, f(casbin_context, r.sub))"},
+		{"keyMatch(r.obj, p.obj) && f(r.obj)", "keyMatch(r.obj, p.obj) && f(casbin_context, r.obj)"},
+		{"gf(r.obj) || f2(r.obj)", "gf(r.obj) || f2(r.obj)"},
+		{`r.obj == "f(x)" && f(r.obj)`, `r.obj == "f(x)" && f(casbin_context, r.obj)`},
+		{`f('f(', r.obj) || r.obj == 'f()'`, `f(casbin_context, 'f(', r.obj) || r.obj == 'f()'`},
+		{"p.obj.f(r.obj)", "p.obj.f(r.obj)"},
+	}
+	for _, tc := range testCases {
+		if res := addContextArgument(tc.matcher, "f"); res != tc.expected {
+			t.Errorf("%s: %s, supposed to be %s", tc.matcher, res, tc.expected)
+		}
+	}
+}
+
+func TestInvalidPolicyEffect(t *testing.T) {
+	m := model.NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("e", "e", "some(where (p.eft == allow)) and !some(where (p.eft == deny))")
+	m.AddDef("m", "m", "r.sub == p.sub && r.obj == p.obj && r.act == p.act")
+
+	if _, err := NewEnforcer(m); err == nil {
+		t.Error("an invalid policy effect should be reported when the model is loaded")
+	}
+
+	m.AddDef("e", "e", "!some(where (p.eft == deny)) && (some(where (p.eft == allow)) || priority(p.eft))")
+	e, err := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data1", "write", false)
+}
+
+func TestModelValidation(t *testing.T) {
+	m := model.NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("m", "m", "r.subject == p.sub && r.obj == p.obj && r.act == p.act")
+
+	if _, err := NewEnforcer(m); err == nil {
+		t.Error("a matcher referencing an undefined token should be reported when the model is loaded")
+	}
+
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	if err := e.SetModel(m); err == nil {
+		t.Error("a matcher referencing an undefined token should be reported when the model is set")
+	}
+
+	// The custom functions are added after the model, so they are checked again when a function is added.
+	e, err := NewEnforcer("examples/keymatch_custom_model.conf", "examples/keymatch2_policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.Enforce("alice", "/alice_data2/myid/using/res_id", "GET")
+	if err == nil || err.Error() != `invalid matchers::m: function "keyMatchCustom" is not defined` {
+		t.Errorf("an undefined function should be reported by name, got %v", err)
+	}
+	_, err = e.EnforceWithMatcher("r_sub == p_sub", "alice", "/alice_data2/myid/using/res_id", "GET")
+	if err != nil {
+		t.Errorf("a custom matcher should not fail because of the model matcher, got %v", err)
+	}
+
+	e.AddFunction("keyMatch", util.KeyMatchFunc)
+	_, err = e.Enforce("alice", "/alice_data2/myid/using/res_id", "GET")
+	if err == nil || err.Error() != `invalid matchers::m: function "keyMatchCustom" is not defined` {
+		t.Errorf("the function should still be reported after another function is added, got %v", err)
+	}
+
+	e.AddFunction("keyMatchCustom", CustomFunctionWrapper)
+	testEnforce(t, e, "alice", "/alice_data2/myid/using/res_id", "GET", true)
+}
+
+func TestPredefinedModel(t *testing.T) {
+	e, err := NewEnforcer("rbac", "examples/rbac_policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data2", "read", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+
+	if err := e.LoadModel(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewEnforcer("no_such_model", "examples/rbac_policy.csv"); err == nil {
+		t.Error("an unknown model should return an error")
+	}
+}
@@ -14,15 +14,19 @@
 
 package casbin
 
+import (
+	"github.com/casbin/casbin/v2/persist"
+)
+
 const (
 	notImplemented = "not implemented"
 )
 
 // addPolicy adds a rule to the current policy.
 func (e *Enforcer) addPolicy(sec string, ptype string, rule []string) (bool, error) {
-	ruleAdded := e.model.AddPolicy(sec, ptype, rule)
-	if !ruleAdded {
-		return ruleAdded, nil
+	ruleAdded, err := e.addPolicyToModel(sec, ptype, rule, PolicySourceAPI)
+	if !ruleAdded || err != nil {
+		return ruleAdded, err
 	}
 
 	if e.adapter != nil && e.autoSave {
@@ -33,7 +37,12 @@ func (e *Enforcer) addPolicy(sec string, ptype string, rule []string) (bool, err
 		}
 
 		if e.watcher != nil {
-			err := e.watcher.Update()
+			var err error
+			if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+				err = watcher.UpdateForAddPolicy(sec, ptype, rule...)
+			} else {
+				err = e.watcher.Update()
+			}
 			if err != nil {
 				return ruleAdded, err
 			}
@@ -43,9 +52,245 @@ func (e *Enforcer) addPolicy(sec string, ptype string, rule []string) (bool, err
 	return ruleAdded, nil
 }
 
+// addPolicyToModel adds a rule to the model, without saving it nor notifying the watcher.
+func (e *Enforcer) addPolicyToModel(sec string, ptype string, rule []string, source PolicySource) (bool, error) {
+	if err := e.model.CheckPriority(sec, ptype, rule); err != nil {
+		return false, err
+	}
+	ast := e.model[sec][ptype]
+	generation := ast.Generation()
+	pos, ruleAdded := e.model.InsertPolicy(sec, ptype, rule)
+	if !ruleAdded {
+		return ruleAdded, nil
+	}
+	// The policy index is built again on the next enforcement when the rule is not the last one.
+	if sec == "p" && pos == len(ast.Policy)-1 {
+		e.policyIndex.appendRule(ptype, ast, generation)
+	}
+	e.notifyPolicyChange(PolicyEvent{Op: PolicyAdd, Sec: sec, PType: ptype, Source: source, Rules: [][]string{rule}})
+	return ruleAdded, nil
+}
+
+// addPolicies adds rules to the current policy.
+// Nothing is added if one of the rules already exists or if the adapter fails to save them.
+func (e *Enforcer) addPolicies(sec string, ptype string, rules [][]string) (bool, error) {
+	for _, rule := range rules {
+		if err := e.model.CheckPriority(sec, ptype, rule); err != nil {
+			return false, err
+		}
+	}
+	if len(rules) == 0 || !e.model.AddPolicies(sec, ptype, rules) {
+		return false, nil
+	}
+
+	if e.adapter != nil && e.autoSave {
+		if err := e.savePolicies(sec, ptype, rules, true); err != nil {
+			e.model.RemovePolicies(sec, ptype, rules)
+			return false, err
+		}
+	}
+	e.notifyPolicyChange(PolicyEvent{Op: PolicyAdd, Sec: sec, PType: ptype, Source: PolicySourceAPI, Rules: rules})
+
+	if e.adapter != nil && e.autoSave && e.watcher != nil {
+		var err error
+		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+			err = watcher.UpdateForAddPolicies(sec, ptype, rules...)
+		} else {
+			err = e.watcher.Update()
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// removePolicies removes rules from the current policy.
+// Nothing is removed if one of the rules does not exist or if the adapter fails to remove them.
+func (e *Enforcer) removePolicies(sec string, ptype string, rules [][]string) (bool, error) {
+	policy := append([][]string(nil), e.model[sec][ptype].Policy...)
+	if len(rules) == 0 || !e.model.RemovePolicies(sec, ptype, rules) {
+		return false, nil
+	}
+
+	if e.adapter != nil && e.autoSave {
+		if err := e.savePolicies(sec, ptype, rules, false); err != nil {
+			// The rules are put back at their positions.
+			e.model.SetPolicy(sec, ptype, policy)
+			return false, err
+		}
+	}
+	e.notifyPolicyChange(PolicyEvent{Op: PolicyRemove, Sec: sec, PType: ptype, Source: PolicySourceAPI, Rules: rules})
+
+	if e.adapter != nil && e.autoSave && e.watcher != nil {
+		var err error
+		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+			err = watcher.UpdateForRemovePolicies(sec, ptype, rules...)
+		} else {
+			err = e.watcher.Update()
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// savePolicies adds or removes rules in the adapter, in one call if it is a BatchAdapter,
+// otherwise rule by rule. If a call fails, the rules already saved are reverted.
+func (e *Enforcer) savePolicies(sec string, ptype string, rules [][]string, add bool) error {
+	if adapter, ok := e.adapter.(persist.BatchAdapter); ok {
+		var err error
+		if add {
+			err = adapter.AddPolicies(sec, ptype, rules)
+		} else {
+			err = adapter.RemovePolicies(sec, ptype, rules)
+		}
+		if err != nil && err.Error() != notImplemented {
+			return err
+		}
+		return nil
+	}
+
+	for i, rule := range rules {
+		var err error
+		if add {
+			err = e.adapter.AddPolicy(sec, ptype, rule)
+		} else {
+			err = e.adapter.RemovePolicy(sec, ptype, rule)
+		}
+		if err == nil || err.Error() == notImplemented {
+			continue
+		}
+
+		for _, saved := range rules[:i] {
+			if add {
+				_ = e.adapter.RemovePolicy(sec, ptype, saved)
+			} else {
+				_ = e.adapter.AddPolicy(sec, ptype, saved)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// updatePolicies replaces rules of the current policy, oldRules[i] is replaced by newRules[i].
+// Nothing is replaced if one of the old rules does not exist, one of the new rules already exists
+// or if the adapter fails to save them.
+func (e *Enforcer) updatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) (bool, error) {
+	for _, rule := range newRules {
+		if err := e.model.CheckPriority(sec, ptype, rule); err != nil {
+			return false, err
+		}
+	}
+	policy := append([][]string(nil), e.model[sec][ptype].Policy...)
+	if len(oldRules) == 0 || !e.model.UpdatePolicies(sec, ptype, oldRules, newRules) {
+		return false, nil
+	}
+
+	if e.adapter != nil && e.autoSave {
+		if err := e.saveUpdatedPolicies(sec, ptype, oldRules, newRules); err != nil {
+			// The old rules are put back at their positions.
+			e.model.SetPolicy(sec, ptype, policy)
+			return false, err
+		}
+	}
+	e.notifyPolicyChange(PolicyEvent{
+		Op:       PolicyUpdate,
+		Sec:      sec,
+		PType:    ptype,
+		Source:   PolicySourceAPI,
+		Rules:    oldRules,
+		NewRules: newRules,
+	})
+
+	if e.adapter != nil && e.autoSave && e.watcher != nil {
+		var err error
+		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+			err = watcher.UpdateForUpdatePolicies(sec, ptype, oldRules, newRules)
+		} else {
+			err = e.watcher.Update()
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// addPoliciesToModel adds rules to the model at once, without saving them nor notifying the watcher.
+// Nothing is added if one of the rules already exists.
+func (e *Enforcer) addPoliciesToModel(sec string, ptype string, rules [][]string, source PolicySource) (bool, error) {
+	for _, rule := range rules {
+		if err := e.model.CheckPriority(sec, ptype, rule); err != nil {
+			return false, err
+		}
+	}
+	if len(rules) == 0 || !e.model.AddPolicies(sec, ptype, rules) {
+		return false, nil
+	}
+	e.notifyPolicyChange(PolicyEvent{Op: PolicyAdd, Sec: sec, PType: ptype, Source: source, Rules: rules})
+	return true, nil
+}
+
+// removePoliciesFromModel removes rules from the model at once, without saving them nor notifying the watcher.
+// Nothing is removed if one of the rules does not exist.
+func (e *Enforcer) removePoliciesFromModel(sec string, ptype string, rules [][]string, source PolicySource) bool {
+	if len(rules) == 0 || !e.model.RemovePolicies(sec, ptype, rules) {
+		return false
+	}
+	e.notifyPolicyChange(PolicyEvent{Op: PolicyRemove, Sec: sec, PType: ptype, Source: source, Rules: rules})
+	return true
+}
+
+// updatePoliciesInModel replaces rules of the model, without saving them nor notifying the watcher.
+// Nothing is replaced if one of the old rules does not exist or one of the new rules already exists.
+func (e *Enforcer) updatePoliciesInModel(sec string, ptype string, oldRules [][]string, newRules [][]string, source PolicySource) (bool, error) {
+	for _, rule := range newRules {
+		if err := e.model.CheckPriority(sec, ptype, rule); err != nil {
+			return false, err
+		}
+	}
+	if len(oldRules) == 0 || !e.model.UpdatePolicies(sec, ptype, oldRules, newRules) {
+		return false, nil
+	}
+	e.notifyPolicyChange(PolicyEvent{Op: PolicyUpdate, Sec: sec, PType: ptype, Source: source, Rules: oldRules, NewRules: newRules})
+	return true, nil
+}
+
+// saveUpdatedPolicies replaces rules in the adapter. If it is not an UpdatableAdapter,
+// the old rules are removed and the new ones are added.
+func (e *Enforcer) saveUpdatedPolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) error {
+	if adapter, ok := e.adapter.(persist.UpdatableAdapter); ok {
+		var err error
+		if len(oldRules) == 1 {
+			err = adapter.UpdatePolicy(sec, ptype, oldRules[0], newRules[0])
+		} else {
+			err = adapter.UpdatePolicies(sec, ptype, oldRules, newRules)
+		}
+		if err != nil && err.Error() != notImplemented {
+			return err
+		}
+		return nil
+	}
+
+	if err := e.savePolicies(sec, ptype, oldRules, false); err != nil {
+		return err
+	}
+	if err := e.savePolicies(sec, ptype, newRules, true); err != nil {
+		_ = e.savePolicies(sec, ptype, oldRules, true)
+		return err
+	}
+	return nil
+}
+
 // removePolicy removes a rule from the current policy.
 func (e *Enforcer) removePolicy(sec string, ptype string, rule []string) (bool, error) {
-	ruleRemoved := e.model.RemovePolicy(sec, ptype, rule)
+	ruleRemoved := e.removePolicyFromModel(sec, ptype, rule, PolicySourceAPI)
 	if !ruleRemoved {
 		return ruleRemoved, nil
 	}
@@ -57,7 +302,12 @@ func (e *Enforcer) removePolicy(sec string, ptype string, rule []string) (bool,
 			}
 		}
 		if e.watcher != nil {
-			err := e.watcher.Update()
+			var err error
+			if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+				err = watcher.UpdateForRemovePolicy(sec, ptype, rule...)
+			} else {
+				err = e.watcher.Update()
+			}
 			if err != nil {
 				return ruleRemoved, err
 			}
@@ -67,9 +317,19 @@ func (e *Enforcer) removePolicy(sec string, ptype string, rule []string) (bool,
 	return ruleRemoved, nil
 }
 
+// removePolicyFromModel removes a rule from the model, without saving it nor notifying the watcher.
+func (e *Enforcer) removePolicyFromModel(sec string, ptype string, rule []string, source PolicySource) bool {
+	ruleRemoved := e.model.RemovePolicy(sec, ptype, rule)
+	if !ruleRemoved {
+		return ruleRemoved
+	}
+	e.notifyPolicyChange(PolicyEvent{Op: PolicyRemove, Sec: sec, PType: ptype, Source: source, Rules: [][]string{rule}})
+	return ruleRemoved
+}
+
 // removeFilteredPolicy removes rules based on field filters from the current policy.
 func (e *Enforcer) removeFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
-	ruleRemoved := e.model.RemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+	ruleRemoved := e.removeFilteredPolicyFromModel(sec, ptype, fieldIndex, fieldValues, PolicySourceAPI)
 	if !ruleRemoved {
 		return ruleRemoved, nil
 	}
@@ -81,7 +341,12 @@ func (e *Enforcer) removeFilteredPolicy(sec string, ptype string, fieldIndex int
 			}
 		}
 		if e.watcher != nil {
-			err := e.watcher.Update()
+			var err error
+			if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+				err = watcher.UpdateForRemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+			} else {
+				err = e.watcher.Update()
+			}
 			if err != nil {
 				return ruleRemoved, err
 			}
@@ -90,3 +355,18 @@ func (e *Enforcer) removeFilteredPolicy(sec string, ptype string, fieldIndex int
 
 	return ruleRemoved, nil
 }
+
+// removeFilteredPolicyFromModel removes rules based on field filters from the model,
+// without saving it nor notifying the watcher.
+func (e *Enforcer) removeFilteredPolicyFromModel(sec string, ptype string, fieldIndex int, fieldValues []string, source PolicySource) bool {
+	var rules [][]string
+	if len(e.policyChangeHandlers) != 0 {
+		rules = e.model.GetFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+	}
+	ruleRemoved := e.model.RemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+	if !ruleRemoved {
+		return ruleRemoved
+	}
+	e.notifyPolicyChange(PolicyEvent{Op: PolicyRemove, Sec: sec, PType: ptype, Source: source, Rules: rules})
+	return ruleRemoved
+}
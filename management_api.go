@@ -14,7 +14,13 @@
 
 package casbin
 
-import "github.com/Knetic/govaluate"
+import (
+	"context"
+	"fmt"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/model"
+)
 
 // GetAllSubjects gets the list of subjects that show up in the current policy.
 func (e *Enforcer) GetAllSubjects() []string {
@@ -137,6 +143,20 @@ func (e *Enforcer) AddNamedPolicy(ptype string, params ...interface{}) (bool, er
 	return e.addPolicy("p", ptype, policy)
 }
 
+// AddPolicies adds authorization rules to the current policy.
+// If one of the rules already exists, the function returns false and none of the rules is added.
+// Otherwise the function returns true by adding the new rules.
+func (e *Enforcer) AddPolicies(rules [][]string) (bool, error) {
+	return e.AddNamedPolicies("p", rules)
+}
+
+// AddNamedPolicies adds authorization rules to the current named policy.
+// If one of the rules already exists, the function returns false and none of the rules is added.
+// Otherwise the function returns true by adding the new rules.
+func (e *Enforcer) AddNamedPolicies(ptype string, rules [][]string) (bool, error) {
+	return e.addPolicies("p", ptype, rules)
+}
+
 // RemovePolicy removes an authorization rule from the current policy.
 func (e *Enforcer) RemovePolicy(params ...interface{}) (bool, error) {
 	return e.RemoveNamedPolicy("p", params...)
@@ -160,6 +180,44 @@ func (e *Enforcer) RemoveNamedPolicy(ptype string, params ...interface{}) (bool,
 	return e.removePolicy("p", ptype, policy)
 }
 
+// RemovePolicies removes authorization rules from the current policy.
+// If one of the rules does not exist, the function returns false and none of the rules is removed.
+func (e *Enforcer) RemovePolicies(rules [][]string) (bool, error) {
+	return e.RemoveNamedPolicies("p", rules)
+}
+
+// RemoveNamedPolicies removes authorization rules from the current named policy.
+// If one of the rules does not exist, the function returns false and none of the rules is removed.
+func (e *Enforcer) RemoveNamedPolicies(ptype string, rules [][]string) (bool, error) {
+	return e.removePolicies("p", ptype, rules)
+}
+
+// UpdatePolicy replaces an authorization rule of the current policy, the new rule takes the position of the old one.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (e *Enforcer) UpdatePolicy(oldRule []string, newRule []string) (bool, error) {
+	return e.UpdateNamedPolicy("p", oldRule, newRule)
+}
+
+// UpdateNamedPolicy replaces an authorization rule of the current named policy, the new rule takes the position of the old one.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (e *Enforcer) UpdateNamedPolicy(ptype string, oldRule []string, newRule []string) (bool, error) {
+	return e.updatePolicies("p", ptype, [][]string{oldRule}, [][]string{newRule})
+}
+
+// UpdatePolicies replaces authorization rules of the current policy, oldRules[i] is replaced by newRules[i].
+// If one of the old rules does not exist or one of the new rules already exists, the function returns false
+// and none of the rules is replaced.
+func (e *Enforcer) UpdatePolicies(oldRules [][]string, newRules [][]string) (bool, error) {
+	return e.UpdateNamedPolicies("p", oldRules, newRules)
+}
+
+// UpdateNamedPolicies replaces authorization rules of the current named policy, oldRules[i] is replaced by newRules[i].
+// If one of the old rules does not exist or one of the new rules already exists, the function returns false
+// and none of the rules is replaced.
+func (e *Enforcer) UpdateNamedPolicies(ptype string, oldRules [][]string, newRules [][]string) (bool, error) {
+	return e.updatePolicies("p", ptype, oldRules, newRules)
+}
+
 // RemoveFilteredNamedPolicy removes an authorization rule from the current named policy, field filters can be specified.
 func (e *Enforcer) RemoveFilteredNamedPolicy(ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
 	return e.removeFilteredPolicy("p", ptype, fieldIndex, fieldValues...)
@@ -214,6 +272,26 @@ func (e *Enforcer) AddNamedGroupingPolicy(ptype string, params ...interface{}) (
 	return ruleAdded, err
 }
 
+// AddGroupingPolicies adds role inheritance rules to the current policy.
+// If one of the rules already exists, the function returns false and none of the rules is added.
+// Otherwise the function returns true by adding the new rules.
+func (e *Enforcer) AddGroupingPolicies(rules [][]string) (bool, error) {
+	return e.AddNamedGroupingPolicies("g", rules)
+}
+
+// AddNamedGroupingPolicies adds named role inheritance rules to the current policy.
+// If one of the rules already exists, the function returns false and none of the rules is added.
+// Otherwise the function returns true by adding the new rules.
+// The role links are built once for all the rules.
+func (e *Enforcer) AddNamedGroupingPolicies(ptype string, rules [][]string) (bool, error) {
+	rulesAdded, err := e.addPolicies("g", ptype, rules)
+
+	if rulesAdded && e.autoBuildRoleLinks {
+		e.BuildRoleLinks()
+	}
+	return rulesAdded, err
+}
+
 // RemoveGroupingPolicy removes a role inheritance rule from the current policy.
 func (e *Enforcer) RemoveGroupingPolicy(params ...interface{}) (bool, error) {
 	return e.RemoveNamedGroupingPolicy("g", params...)
@@ -245,6 +323,41 @@ func (e *Enforcer) RemoveNamedGroupingPolicy(ptype string, params ...interface{}
 	return ruleRemoved, err
 }
 
+// RemoveGroupingPolicies removes role inheritance rules from the current policy.
+// If one of the rules does not exist, the function returns false and none of the rules is removed.
+func (e *Enforcer) RemoveGroupingPolicies(rules [][]string) (bool, error) {
+	return e.RemoveNamedGroupingPolicies("g", rules)
+}
+
+// RemoveNamedGroupingPolicies removes role inheritance rules from the current named policy.
+// If one of the rules does not exist, the function returns false and none of the rules is removed.
+// The role links are built once for all the rules.
+func (e *Enforcer) RemoveNamedGroupingPolicies(ptype string, rules [][]string) (bool, error) {
+	rulesRemoved, err := e.removePolicies("g", ptype, rules)
+
+	if rulesRemoved && e.autoBuildRoleLinks {
+		e.BuildRoleLinks()
+	}
+	return rulesRemoved, err
+}
+
+// UpdateGroupingPolicy replaces a role inheritance rule of the current policy.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (e *Enforcer) UpdateGroupingPolicy(oldRule []string, newRule []string) (bool, error) {
+	return e.UpdateNamedGroupingPolicy("g", oldRule, newRule)
+}
+
+// UpdateNamedGroupingPolicy replaces a named role inheritance rule of the current policy.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (e *Enforcer) UpdateNamedGroupingPolicy(ptype string, oldRule []string, newRule []string) (bool, error) {
+	ruleUpdated, err := e.updatePolicies("g", ptype, [][]string{oldRule}, [][]string{newRule})
+
+	if ruleUpdated && e.autoBuildRoleLinks {
+		e.BuildRoleLinks()
+	}
+	return ruleUpdated, err
+}
+
 // RemoveFilteredNamedGroupingPolicy removes a role inheritance rule from the current named policy, field filters can be specified.
 func (e *Enforcer) RemoveFilteredNamedGroupingPolicy(ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
 	ruleRemoved, err := e.removeFilteredPolicy("g", ptype, fieldIndex, fieldValues...)
@@ -258,4 +371,25 @@ func (e *Enforcer) RemoveFilteredNamedGroupingPolicy(ptype string, fieldIndex in
 // AddFunction adds a customized function.
 func (e *Enforcer) AddFunction(name string, function govaluate.ExpressionFunction) {
 	e.fm.AddFunction(name, function)
+	e.invalidateMatcherCache()
+	e.validateFunctions()
+}
+
+// AddContextFunction adds a customized function that receives the context passed to EnforceCtx()
+// as its first argument, the matchers call it with the remaining arguments only.
+// Enforce() and the other functions without a context pass context.Background().
+func (e *Enforcer) AddContextFunction(name string, function model.ContextFunction) {
+	e.fm.AddFunction(name, func(args ...interface{}) (interface{}, error) {
+		ctx, ok := args[0].(context.Context)
+		if !ok {
+			return nil, fmt.Errorf("%s: missing context argument", name)
+		}
+		return function(ctx, args[1:]...)
+	})
+	if e.contextFunctions == nil {
+		e.contextFunctions = map[string]bool{}
+	}
+	e.contextFunctions[name] = true
+	e.invalidateMatcherCache()
+	e.validateFunctions()
 }
@@ -15,8 +15,12 @@
 package casbin
 
 import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
 	"github.com/casbin/casbin/v2/util"
 )
 
@@ -206,3 +210,247 @@ func TestModifyGroupingPolicyAPI(t *testing.T) {
 	testGetUsers(t, e, "data2_admin", []string{})
 	testGetUsers(t, e, "data3_admin", []string{"eve"})
 }
+
+func TestLoadDuplicatedPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	if err := ioutil.WriteFile(path, []byte("p, alice, data1, read\np, bob, data2, write\np, alice, data1, read\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The duplicated lines are loaded as they are, and removed one at a time.
+	e, _ := NewEnforcer("examples/basic_model.conf", path)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"alice", "data1", "read"}})
+
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}, {"alice", "data1", "read"}})
+	testHasPolicy(t, e, []string{"alice", "data1", "read"}, true)
+	testEnforce(t, e, "alice", "data1", "read", true)
+
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}})
+	testHasPolicy(t, e, []string{"alice", "data1", "read"}, false)
+	testEnforce(t, e, "alice", "data1", "read", false)
+}
+
+func TestModifyPoliciesAPI(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	rules := [][]string{
+		{"eve", "data3", "read"},
+		{"jack", "data4", "read"},
+	}
+	if ok, _ := e.AddPolicies(rules); !ok {
+		t.Error("the rules should be added")
+	}
+	// None of the rules is added when one of them exists.
+	if ok, _ := e.AddPolicies([][]string{{"leyo", "data4", "write"}, {"eve", "data3", "read"}}); ok {
+		t.Error("the rules should not be added")
+	}
+	if ok, _ := e.AddNamedPolicies("p", [][]string{{"leyo", "data4", "write"}, {"leyo", "data4", "write"}}); ok {
+		t.Error("duplicated rules should not be added")
+	}
+
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"eve", "data3", "read"},
+		{"jack", "data4", "read"}})
+	testEnforce(t, e, "jack", "data4", "read", true)
+
+	// None of the rules is removed when one of them does not exist.
+	if ok, _ := e.RemovePolicies([][]string{{"alice", "data1", "read"}, {"leyo", "data4", "write"}}); ok {
+		t.Error("the rules should not be removed")
+	}
+	if ok, _ := e.RemoveNamedPolicies("p", [][]string{{"alice", "data1", "read"}, {"eve", "data3", "read"}}); !ok {
+		t.Error("the rules should be removed")
+	}
+
+	testGetPolicy(t, e, [][]string{
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"jack", "data4", "read"}})
+	testEnforce(t, e, "alice", "data1", "read", false)
+
+	e.AddGroupingPolicies([][]string{{"bob", "data2_admin"}, {"eve", "data2_admin"}})
+	testGetUsers(t, e, "data2_admin", []string{"alice", "bob", "eve"})
+	e.RemoveNamedGroupingPolicies("g", [][]string{{"alice", "data2_admin"}, {"bob", "data2_admin"}})
+	testGetUsers(t, e, "data2_admin", []string{"eve"})
+}
+
+type batchAdapter struct {
+	*fileadapter.Adapter
+	calls int
+	err   error
+}
+
+func (a *batchAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	a.calls++
+	return a.err
+}
+
+func (a *batchAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	a.calls++
+	return a.err
+}
+
+type countingWatcher struct {
+	SampleWatcher
+	updates int
+}
+
+func (w *countingWatcher) Update() error {
+	w.updates++
+	return nil
+}
+
+func TestBatchAdapter(t *testing.T) {
+	a := &batchAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	w := &countingWatcher{}
+	_ = e.SetWatcher(w)
+
+	rules := [][]string{{"eve", "data3", "read"}, {"jack", "data4", "read"}, {"leyo", "data4", "write"}}
+	if ok, err := e.AddPolicies(rules); !ok || err != nil {
+		t.Errorf("AddPolicies: %t, %v", ok, err)
+	}
+	if a.calls != 1 || w.updates != 1 {
+		t.Errorf("%d adapter calls and %d watcher updates, supposed to be 1 and 1", a.calls, w.updates)
+	}
+
+	// The model is not changed when the adapter fails.
+	a.err = errors.New("storage failure")
+	if ok, err := e.RemovePolicies(rules[:2]); ok || err == nil {
+		t.Errorf("RemovePolicies: %t, %v", ok, err)
+	}
+	// The rules are put back at their positions and can still be found.
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"eve", "data3", "read"},
+		{"jack", "data4", "read"},
+		{"leyo", "data4", "write"},
+	})
+	testHasPolicy(t, e, rules[0], true)
+	testHasPolicy(t, e, rules[1], true)
+	testEnforce(t, e, "eve", "data3", "read", true)
+	testEnforce(t, e, "jack", "data4", "read", true)
+	if ok, _ := e.AddPolicies([][]string{{"tom", "data5", "read"}}); ok {
+		t.Error("the rule should not be added")
+	}
+	testHasPolicy(t, e, []string{"tom", "data5", "read"}, false)
+	if w.updates != 1 {
+		t.Errorf("%d watcher updates, supposed to be 1", w.updates)
+	}
+
+	a.err = nil
+	if ok, _ := e.RemovePolicies(rules[:2]); !ok {
+		t.Error("the rules should be removed")
+	}
+	testEnforce(t, e, "eve", "data3", "read", false)
+	testEnforce(t, e, "leyo", "data4", "write", true)
+}
+
+func TestUpdatePolicyAPI(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	if ok, _ := e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); !ok {
+		t.Error("the rule should be updated")
+	}
+	if ok, _ := e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); ok {
+		t.Error("a missing rule should not be updated")
+	}
+	if ok, _ := e.UpdateNamedPolicy("p", []string{"bob", "data2", "write"}, []string{"data2_admin", "data2", "read"}); ok {
+		t.Error("a rule should not be updated to an existing rule")
+	}
+	// The rules keep their positions, even when they are swapped.
+	if ok, _ := e.UpdatePolicies(
+		[][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		[][]string{{"data2_admin", "data2", "write"}, {"data2_admin", "data2", "read"}}); !ok {
+		t.Error("the rules should be swapped")
+	}
+
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "write"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "write"},
+		{"data2_admin", "data2", "read"}})
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "alice", "data1", "write", true)
+
+	e.UpdateGroupingPolicy([]string{"alice", "data2_admin"}, []string{"bob", "data2_admin"})
+	testGetUsers(t, e, "data2_admin", []string{"bob"})
+	testEnforce(t, e, "alice", "data2", "read", false)
+	testEnforce(t, e, "bob", "data2", "read", true)
+}
+
+func TestUpdatePolicyWithPriority(t *testing.T) {
+	e, _ := NewEnforcer("examples/priority_model_explicit.conf", "examples/priority_policy_explicit.csv")
+
+	// The rule keeps its position among the rules of the same priority.
+	e.UpdatePolicy([]string{"1", "alice", "data1", "write", "allow"}, []string{"1", "alice", "data1", "write", "deny"})
+	testEnforce(t, e, "alice", "data1", "write", false)
+	if rule := e.GetPolicy()[0]; !util.ArrayEquals(rule, []string{"1", "alice", "data1", "write", "deny"}) {
+		t.Errorf("the first rule is %v", rule)
+	}
+
+	// A rule whose priority changes is moved.
+	e.UpdatePolicy([]string{"1", "bob", "data2", "read", "deny"}, []string{"20", "bob", "data2", "read", "deny"})
+	testEnforce(t, e, "bob", "data2", "read", true)
+	policy := e.GetPolicy()
+	if rule := policy[len(policy)-1]; !util.ArrayEquals(rule, []string{"20", "bob", "data2", "read", "deny"}) {
+		t.Errorf("the last rule is %v", rule)
+	}
+}
+
+type updatableAdapter struct {
+	*fileadapter.Adapter
+	calls int
+	err   error
+}
+
+func (a *updatableAdapter) UpdatePolicy(sec string, ptype string, oldRule []string, newRule []string) error {
+	a.calls++
+	return a.err
+}
+
+func (a *updatableAdapter) UpdatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) error {
+	a.calls++
+	return a.err
+}
+
+func TestUpdatableAdapter(t *testing.T) {
+	a := &updatableAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	w := &countingWatcher{}
+	_ = e.SetWatcher(w)
+
+	e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"})
+	e.UpdatePolicies([][]string{{"bob", "data2", "write"}}, [][]string{{"bob", "data2", "read"}})
+	if a.calls != 2 || w.updates != 2 {
+		t.Errorf("%d adapter calls and %d watcher updates, supposed to be 2 and 2", a.calls, w.updates)
+	}
+
+	// The old rule is put back when the adapter fails.
+	a.err = errors.New("storage failure")
+	if ok, err := e.UpdatePolicy([]string{"alice", "data1", "write"}, []string{"alice", "data1", "read"}); ok || err == nil {
+		t.Errorf("UpdatePolicy: %t, %v", ok, err)
+	}
+	testHasPolicy(t, e, []string{"alice", "data1", "write"}, true)
+	testHasPolicy(t, e, []string{"alice", "data1", "read"}, false)
+	testEnforce(t, e, "alice", "data1", "write", true)
+	testEnforce(t, e, "alice", "data1", "read", false)
+	if w.updates != 2 {
+		t.Errorf("%d watcher updates, supposed to be 2", w.updates)
+	}
+
+	a.err = nil
+	if ok, _ := e.UpdatePolicy([]string{"alice", "data1", "write"}, []string{"alice", "data1", "read"}); !ok {
+		t.Error("the rule should be updated")
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+}
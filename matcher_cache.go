@@ -0,0 +1,95 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sync"
+
+	"github.com/Knetic/govaluate"
+)
+
+// maxCustomMatchers is the number of compiled custom matchers (passed to EnforceWithMatcher)
+// kept by an enforcer, the oldest one is evicted when the limit is reached.
+const maxCustomMatchers = 128
+
+// compiledMatcher is a matcher expression parsed together with the token indexes it is evaluated with.
+type compiledMatcher struct {
+	expression *govaluate.EvaluableExpression
+	rTokens    map[string]int
+	pTokens    map[string]int
+
+	// indexClauses are the equalities used to look up candidate rules in the policy index.
+	indexClauses []indexClause
+	// subjectRoleType is the role definition called for the subject of the request, for "subjectPriority".
+	subjectRoleType string
+}
+
+// matcherCache stores compiled matchers, so that they are only parsed again when
+// the model, the function map or the role manager changes.
+type matcherCache struct {
+	mutex sync.RWMutex
+
+	model map[string]*compiledMatcher
+
+	custom      map[string]*compiledMatcher
+	customOrder []string
+}
+
+func newMatcherCache() *matcherCache {
+	return &matcherCache{
+		model:  make(map[string]*compiledMatcher),
+		custom: make(map[string]*compiledMatcher),
+	}
+}
+
+func (c *matcherCache) get(key string, custom bool) (*compiledMatcher, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if custom {
+		cm, ok := c.custom[key]
+		return cm, ok
+	}
+	cm, ok := c.model[key]
+	return cm, ok
+}
+
+func (c *matcherCache) put(key string, custom bool, cm *compiledMatcher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !custom {
+		c.model[key] = cm
+		return
+	}
+
+	if _, ok := c.custom[key]; !ok {
+		if len(c.customOrder) >= maxCustomMatchers {
+			delete(c.custom, c.customOrder[0])
+			c.customOrder = c.customOrder[1:]
+		}
+		c.customOrder = append(c.customOrder, key)
+	}
+	c.custom[key] = cm
+}
+
+func (c *matcherCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.model = make(map[string]*compiledMatcher)
+	c.custom = make(map[string]*compiledMatcher)
+	c.customOrder = nil
+}
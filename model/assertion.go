@@ -17,9 +17,11 @@ package model
 import (
 	"errors"
 	"strings"
+	"sync/atomic"
 
 	"github.com/casbin/casbin/v2/log"
 	"github.com/casbin/casbin/v2/rbac"
+	"github.com/casbin/casbin/v2/util"
 )
 
 // Assertion represents an expression in a section of the model.
@@ -30,6 +32,177 @@ type Assertion struct {
 	Tokens []string
 	Policy [][]string
 	RM     rbac.RoleManager
+
+	// policyEntries[i] indexes Policy[i], policyMap finds the entry of the first rule with a key.
+	policyEntries []*policyEntry
+	policyMap     map[string]*policyEntry
+	generation    uint64
+}
+
+// policyGenerations numbers the changes of all the policies, so that a generation identifies
+// the state of a policy even across models.
+var policyGenerations uint64
+
+// Generation returns the generation of Policy, it changes whenever the rules are changed by the model.
+// The indexes built from Policy for a generation are stale once it changed. Policy must not be
+// changed directly without calling Model.IndexPolicies() afterwards.
+func (ast *Assertion) Generation() uint64 {
+	return ast.generation
+}
+
+// changed records that Policy changed.
+func (ast *Assertion) changed() {
+	ast.generation = atomic.AddUint64(&policyGenerations, 1)
+}
+
+// policyEntry is the index entry of a rule of Policy. It keeps the key of the rule,
+// so that shifting the rules only updates the positions of the entries.
+type policyEntry struct {
+	key string
+	pos int
+	// next is the entry of the following rule with the same key, if Policy has duplicated rules.
+	next *policyEntry
+}
+
+// policyKey returns the key of a rule in policyMap.
+func policyKey(rule []string) string {
+	return strings.Join(rule, "\x1f")
+}
+
+// buildPolicyMap indexes the rules of Policy.
+func (ast *Assertion) buildPolicyMap() {
+	ast.policyEntries = make([]*policyEntry, len(ast.Policy))
+	ast.policyMap = make(map[string]*policyEntry, len(ast.Policy))
+	for i, rule := range ast.Policy {
+		entry := &policyEntry{key: policyKey(rule), pos: i}
+		ast.policyEntries[i] = entry
+		ast.link(entry)
+	}
+	ast.changed()
+}
+
+// link adds the entry to policyMap, after the entries of the same key at lower positions.
+func (ast *Assertion) link(entry *policyEntry) {
+	head, ok := ast.policyMap[entry.key]
+	if !ok || head.pos > entry.pos {
+		entry.next = head
+		ast.policyMap[entry.key] = entry
+		return
+	}
+	for head.next != nil && head.next.pos < entry.pos {
+		head = head.next
+	}
+	entry.next = head.next
+	head.next = entry
+}
+
+// unlink removes the entry from policyMap.
+func (ast *Assertion) unlink(entry *policyEntry) {
+	head := ast.policyMap[entry.key]
+	if head == entry {
+		if entry.next == nil {
+			delete(ast.policyMap, entry.key)
+		} else {
+			ast.policyMap[entry.key] = entry.next
+		}
+	} else {
+		for head.next != entry {
+			head = head.next
+		}
+		head.next = entry.next
+	}
+	entry.next = nil
+}
+
+// position returns the position of the first rule equal to rule in Policy, or -1 if there is no such rule.
+// It does not build the index, so that it can be called by concurrent readers.
+func (ast *Assertion) position(rule []string) int {
+	if ast.policyMap != nil {
+		if entry, ok := ast.policyMap[policyKey(rule)]; ok {
+			return entry.pos
+		}
+		return -1
+	}
+
+	for i, r := range ast.Policy {
+		if util.ArrayEquals(rule, r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// updatePolicyMap builds the index if Policy was not indexed yet.
+func (ast *Assertion) updatePolicyMap() {
+	if ast.policyMap == nil {
+		ast.buildPolicyMap()
+	}
+}
+
+// insertRule inserts rule at position pos of Policy, the rules after it are shifted.
+func (ast *Assertion) insertRule(pos int, rule []string) {
+	ast.Policy = append(ast.Policy, nil)
+	copy(ast.Policy[pos+1:], ast.Policy[pos:])
+	ast.Policy[pos] = rule
+
+	ast.policyEntries = append(ast.policyEntries, nil)
+	copy(ast.policyEntries[pos+1:], ast.policyEntries[pos:])
+	for _, entry := range ast.policyEntries[pos+1:] {
+		entry.pos++
+	}
+	entry := &policyEntry{key: policyKey(rule), pos: pos}
+	ast.policyEntries[pos] = entry
+	ast.link(entry)
+	ast.changed()
+}
+
+// replaceRule replaces the rule at position pos of Policy, the entry must be unlinked first.
+func (ast *Assertion) replaceRule(pos int, rule []string) {
+	ast.Policy[pos] = rule
+	entry := &policyEntry{key: policyKey(rule), pos: pos}
+	ast.policyEntries[pos] = entry
+	ast.link(entry)
+	ast.changed()
+}
+
+// removeRule removes the rule at position pos of Policy, the rules after it are shifted.
+func (ast *Assertion) removeRule(pos int) {
+	ast.unlink(ast.policyEntries[pos])
+
+	n := len(ast.Policy) - 1
+	copy(ast.Policy[pos:], ast.Policy[pos+1:])
+	ast.Policy[n] = nil
+	ast.Policy = ast.Policy[:n]
+
+	copy(ast.policyEntries[pos:], ast.policyEntries[pos+1:])
+	ast.policyEntries[n] = nil
+	ast.policyEntries = ast.policyEntries[:n]
+	for _, entry := range ast.policyEntries[pos:] {
+		entry.pos--
+	}
+	ast.changed()
+}
+
+// removeRules removes the rules at the positions, the other rules keep their order.
+func (ast *Assertion) removeRules(positions map[int]bool) {
+	n := 0
+	for i, entry := range ast.policyEntries {
+		if positions[i] {
+			ast.unlink(entry)
+			continue
+		}
+		ast.Policy[n] = ast.Policy[i]
+		entry.pos = n
+		ast.policyEntries[n] = entry
+		n++
+	}
+	for i := n; i < len(ast.Policy); i++ {
+		ast.Policy[i] = nil
+		ast.policyEntries[i] = nil
+	}
+	ast.Policy = ast.Policy[:n]
+	ast.policyEntries = ast.policyEntries[:n]
+	ast.changed()
 }
 
 func (ast *Assertion) buildRoleLinks(rm rbac.RoleManager) error {
@@ -0,0 +1,151 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	tokenRegex    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	roleNameRegex = regexp.MustCompile(`^g[0-9]*$`)
+)
+
+// Builder builds a model in code, e.g.
+//
+//	m, err := model.NewBuilder().
+//		Request("sub", "obj", "act").
+//		Policy("sub", "obj", "act").
+//		Role("g", 2).
+//		Effect(effect.AllowOverride).
+//		Matcher("g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act").
+//		Build()
+//
+// Calling Request, Policy, Effect or Matcher again adds the next numbered definition, e.g. r2.
+// The first mistake is reported by Build.
+type Builder struct {
+	model Model
+	err   error
+}
+
+// NewBuilder creates a builder of an empty model.
+func NewBuilder() *Builder {
+	return &Builder{model: NewModel()}
+}
+
+// nextKey returns the key of the next numbered definition of the section.
+func (b *Builder) nextKey(sec string) string {
+	return sec + getKeySuffix(len(b.model[sec])+1)
+}
+
+func (b *Builder) fail(format string, a ...interface{}) *Builder {
+	if b.err == nil {
+		b.err = fmt.Errorf(format, a...)
+	}
+	return b
+}
+
+func (b *Builder) addTokens(sec string, tokens []string) *Builder {
+	key := b.nextKey(sec)
+	if len(tokens) == 0 {
+		return b.fail("%s::%s: no tokens", sectionNameMap[sec], key)
+	}
+	seen := map[string]bool{}
+	for _, token := range tokens {
+		if !tokenRegex.MatchString(token) {
+			return b.fail("%s::%s: invalid token %q", sectionNameMap[sec], key, token)
+		}
+		if seen[token] {
+			return b.fail("%s::%s: duplicate token %q", sectionNameMap[sec], key, token)
+		}
+		seen[token] = true
+	}
+
+	b.model.AddDef(sec, key, strings.Join(tokens, ", "))
+	return b
+}
+
+// Request adds a request definition with the tokens, e.g. "sub", "obj", "act".
+func (b *Builder) Request(tokens ...string) *Builder {
+	return b.addTokens("r", tokens)
+}
+
+// Policy adds a policy definition with the tokens, e.g. "sub", "obj", "act", "eft".
+func (b *Builder) Policy(tokens ...string) *Builder {
+	return b.addTokens("p", tokens)
+}
+
+// Role adds the role definition name, e.g. "g" or "g2", whose rules have arity fields:
+// 2 for a user and a role, 3 with a domain.
+func (b *Builder) Role(name string, arity int) *Builder {
+	if !roleNameRegex.MatchString(name) {
+		return b.fail("%s: invalid name %q", sectionNameMap["g"], name)
+	}
+	if _, ok := b.model["g"][name]; ok {
+		return b.fail("%s::%s: already defined", sectionNameMap["g"], name)
+	}
+	if arity < 2 {
+		return b.fail("%s::%s: the arity should be at least 2, got %d", sectionNameMap["g"], name, arity)
+	}
+
+	b.model.AddDef("g", name, strings.Repeat("_, ", arity-1)+"_")
+	return b
+}
+
+// Effect adds a policy effect, e.g. effect.AllowOverride. The expression is not checked since
+// a custom effector may support other ones, the enforcer checks it for the default effector.
+func (b *Builder) Effect(expr string) *Builder {
+	if strings.TrimSpace(expr) == "" {
+		return b.fail("%s::%s: empty policy effect", sectionNameMap["e"], b.nextKey("e"))
+	}
+
+	b.model.AddDef("e", b.nextKey("e"), expr)
+	return b
+}
+
+// Matcher adds a matcher, it is checked against the definitions by Build.
+func (b *Builder) Matcher(expr string) *Builder {
+	if strings.TrimSpace(expr) == "" {
+		return b.fail("%s::%s: empty matcher", sectionNameMap["m"], b.nextKey("m"))
+	}
+
+	b.model.AddDef("m", b.nextKey("m"), expr)
+	return b
+}
+
+// Build returns the model, or the first mistake found. The role definitions must be called with as many
+// arguments as they have fields, but the functions are not checked as they are added to the enforcer.
+func (b *Builder) Build() (Model, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	var missing []string
+	for _, sec := range requiredSections {
+		if !b.model.hasSection(sec) {
+			missing = append(missing, sectionNameMap[sec])
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required sections: %s", strings.Join(missing, ","))
+	}
+
+	if err := b.model.Validate(nil); err != nil {
+		return nil, err
+	}
+	return b.model, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2/effect"
+)
+
+func TestBuilder(t *testing.T) {
+	m, err := NewBuilder().
+		Request("sub", "dom", "obj", "act").
+		Policy("sub", "dom", "obj", "act").
+		Role("g", 3).
+		Effect(effect.AllowOverride).
+		Matcher("g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj && r.act == p.act").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := NewModelFromFile(filepath.Join("..", "examples", "rbac_with_domains_model.conf"))
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("%s, supposed to be %s", m.ToText(), expected.ToText())
+	}
+
+	m, err = NewBuilder().
+		Request("sub", "obj", "act").
+		Request("sub", "tenant", "act").
+		Policy("sub", "obj", "act").
+		Policy("sub", "tenant", "act", "eft").
+		Role("g", 2).
+		Effect(effect.AllowOverride).
+		Effect(effect.AllowAndDeny).
+		Matcher("g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act").
+		Matcher("g(r2.sub, p2.sub) && r2.tenant == p2.tenant && r2.act == p2.act").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["m"]["m2"]; !ok {
+		t.Error("the second matcher should be m2")
+	}
+	if tokens := m["p"]["p2"].Tokens; strings.Join(tokens, ",") != "p2_sub,p2_tenant,p2_act,p2_eft" {
+		t.Errorf("p2 tokens: %v", tokens)
+	}
+	// The expressions of custom effectors are accepted.
+	_, err = NewBuilder().
+		Request("sub", "obj", "act").
+		Policy("sub", "obj", "act").
+		Effect("some(where (p.eft == permit))").
+		Matcher("r.sub == p.sub && r.obj == p.obj && r.act == p.act").
+		Build()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	valid := func() *Builder {
+		return NewBuilder().Request("sub", "obj", "act").Policy("sub", "obj", "act").Effect(effect.AllowOverride)
+	}
+
+	testCases := []struct {
+		builder *Builder
+		err     string
+	}{
+		{NewBuilder().Request().Policy("sub"), "request_definition::r: no tokens"},
+		{NewBuilder().Request("sub", "obj.id"), `request_definition::r: invalid token "obj.id"`},
+		{NewBuilder().Request("sub").Policy("sub", "sub"), `policy_definition::p: duplicate token "sub"`},
+		{valid().Role("r", 2), `role_definition: invalid name "r"`},
+		{valid().Role("g", 1), "role_definition::g: the arity should be at least 2, got 1"},
+		{valid().Role("g", 2).Role("g", 3), "role_definition::g: already defined"},
+		{valid().Effect(" "), "policy_effect::e2: empty policy effect"},
+		{valid().Matcher(" "), "matchers::m: empty matcher"},
+		{valid(), "missing required sections: matchers"},
+		{valid().Matcher("r.sub == p.subject"), `invalid matchers::m: "p.subject" is not defined in policy_definition::p`},
+		{valid().Role("g", 2).Matcher("g(r.sub, p.sub, r.obj)"), "invalid matchers::m: g of role_definition expects 2 arguments, got 3"},
+	}
+	for _, tc := range testCases {
+		_, err := tc.builder.Build()
+		if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+			t.Errorf("%v, supposed to be %s", err, tc.err)
+		}
+	}
+}
@@ -15,6 +15,8 @@
 package model
 
 import (
+	"context"
+
 	"github.com/Knetic/govaluate"
 	"github.com/casbin/casbin/v2/util"
 )
@@ -22,6 +24,10 @@ import (
 // FunctionMap represents the collection of Function.
 type FunctionMap map[string]govaluate.ExpressionFunction
 
+// ContextFunction represents a function of a matcher that also receives the context of the enforcement,
+// e.g. to read request scoped values or to stop a lookup when the context is cancelled.
+type ContextFunction func(ctx context.Context, args ...interface{}) (interface{}, error)
+
 // AddFunction adds an expression function.
 func (fm FunctionMap) AddFunction(name string, function govaluate.ExpressionFunction) {
 	fm[name] = function
@@ -16,6 +16,8 @@ package model
 
 import (
 	"fmt"
+	"io/ioutil"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -38,6 +40,9 @@ var sectionNameMap = map[string]string{
 	"m": "matchers",
 }
 
+// The order of the sections in a CONF file.
+var sectionOrder = []string{"r", "p", "g", "e", "m"}
+
 // Minimal required sections for a model to be valid
 var requiredSections = []string{"r", "p", "e", "m"}
 
@@ -159,6 +164,19 @@ func (model Model) loadModelFromConfig(cfg config.ConfigInterface) error {
 	return nil
 }
 
+// CopyDefinitions returns a model with the definitions and the role managers of the model but no rules,
+// e.g. to load a policy without changing the model until it is loaded.
+func (model Model) CopyDefinitions() Model {
+	m := NewModel()
+	for sec, astMap := range model {
+		m[sec] = AssertionMap{}
+		for key, ast := range astMap {
+			m[sec][key] = &Assertion{Key: ast.Key, Value: ast.Value, Tokens: ast.Tokens, RM: ast.RM}
+		}
+	}
+	return m
+}
+
 func (model Model) hasSection(sec string) bool {
 	section := model[sec]
 	return section != nil
@@ -173,3 +191,51 @@ func (model Model) PrintModel() {
 		}
 	}
 }
+
+// ToText returns the model as the text of a CONF file. The sections and the numbered definitions
+// are written in a canonical order, loading the text again gives an equivalent model.
+func (model Model) ToText() string {
+	var b strings.Builder
+	for _, sec := range sectionOrder {
+		if len(model[sec]) == 0 {
+			continue
+		}
+		if b.Len() != 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("[" + sectionNameMap[sec] + "]\n")
+
+		keys := make([]string, 0, len(model[sec]))
+		for key := range model[sec] {
+			keys = append(keys, key)
+		}
+		// "r" < "r2" < "r10"
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+
+		for _, key := range keys {
+			ast := model[sec][key]
+			value := ast.Value
+			if sec == "r" || sec == "p" {
+				tokens := make([]string, len(ast.Tokens))
+				for i, token := range ast.Tokens {
+					tokens[i] = strings.TrimPrefix(token, key+"_")
+				}
+				value = strings.Join(tokens, ", ")
+			} else {
+				value = util.UnescapeAssertion(value)
+			}
+			b.WriteString(key + " = " + value + "\n")
+		}
+	}
+	return b.String()
+}
+
+// SaveModel saves the model to a CONF file, see ToText().
+func (model Model) SaveModel(path string) error {
+	return ioutil.WriteFile(path, []byte(model.ToText()), 0644)
+}
@@ -122,3 +122,303 @@ func TestModel_AddDef(t *testing.T) {
 		t.Errorf("empty assertion value should not be added")
 	}
 }
+
+func TestValidate(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("..", "examples", "*.conf"))
+	for _, file := range files {
+		m, err := NewModelFromFile(file)
+		if err != nil {
+			continue
+		}
+		if err := m.Validate(nil); err != nil {
+			t.Errorf("%s: %s", file, err)
+		}
+	}
+
+	testCases := []struct {
+		matcher string
+		err     string
+	}{
+		{"r.sub == p.sub && r.obj == p.obj && r.act == p.act", ""},
+		{"g(r.sub, p.sub) && r.obj.Owner == p.obj && r.act in ('read', 'write')", ""},
+		{"r.sub.IsAdmin() || keyMatch(r.obj, p.obj) && r.act == \"g(x)\"", ""},
+		{"r.subject == p.sub", `invalid matchers::m: "r.subject" is not defined in request_definition::r`},
+		{"r.sub == p.sub && p.eft == 'allow'", `invalid matchers::m: "p.eft" is not defined in policy_definition::p`},
+		{"r2.sub == p.sub", `invalid matchers::m: "r2.sub" references request_definition::r2 which is not defined`},
+		{"sub == p.sub", `invalid matchers::m: unknown identifier "sub"`},
+		{"g(r.sub, p.sub, r.obj)", "invalid matchers::m: g of role_definition expects 2 arguments, got 3"},
+		{"g(r.sub) && r.obj == p.obj", "invalid matchers::m: g of role_definition expects 2 arguments, got 1"},
+		{"g2(r.sub, keyMatch(r.obj, p.obj), p.act)", ""},
+		{"g2(r.sub, p.sub) && r.obj == p.obj", "invalid matchers::m: g2 of role_definition expects 3 arguments, got 2"},
+		{"keyMatch5(r.obj, p.obj)", `invalid matchers::m: function "keyMatch5" is not defined`},
+	}
+	for _, tc := range testCases {
+		m := NewModel()
+		m.AddDef("r", "r", "sub, obj, act")
+		m.AddDef("p", "p", "sub, obj, act")
+		m.AddDef("g", "g", "_, _")
+		m.AddDef("g", "g2", "_, _, _")
+		m.AddDef("e", "e", "some(where (p.eft == allow))")
+		m.AddDef("m", "m", tc.matcher)
+
+		err := m.Validate(LoadFunctionMap())
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: %s", tc.matcher, err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%s: %v, supposed to be %s", tc.matcher, err, tc.err)
+		}
+	}
+
+	// The functions are not checked without a function map.
+	m := NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("m", "m", "keyMatch5(r.obj, r.sub)")
+	if err := m.Validate(nil); err != nil {
+		t.Error(err)
+	}
+
+	m.AddDef("g", "g", "_")
+	if err := m.Validate(nil); err == nil || !strings.Contains(err.Error(), "role_definition::g") {
+		t.Errorf("%v, supposed to name role_definition::g", err)
+	}
+}
+
+func testModelEquals(t *testing.T, name string, m Model, m2 Model) {
+	t.Helper()
+	for _, sec := range sectionOrder {
+		if len(m[sec]) != len(m2[sec]) {
+			t.Errorf("%s: %s has %d definitions, supposed to be %d", name, sec, len(m2[sec]), len(m[sec]))
+			continue
+		}
+		for key, ast := range m[sec] {
+			ast2, ok := m2[sec][key]
+			if !ok {
+				t.Errorf("%s: %s is missing", name, key)
+				continue
+			}
+			if ast.Value != ast2.Value || strings.Join(ast.Tokens, ",") != strings.Join(ast2.Tokens, ",") {
+				t.Errorf("%s: %s = %s %v, supposed to be %s %v", name, key, ast2.Value, ast2.Tokens, ast.Value, ast.Tokens)
+			}
+		}
+	}
+}
+
+func TestToText(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("..", "examples", "*.conf"))
+	for _, file := range files {
+		m, err := NewModelFromFile(file)
+		if err != nil {
+			continue
+		}
+
+		text := m.ToText()
+		m2, err := NewModelFromString(text)
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+			continue
+		}
+		testModelEquals(t, file, m, m2)
+		if text2 := m2.ToText(); text2 != text {
+			t.Errorf("%s: the text is not canonical:\n%s\n%s", file, text, text2)
+		}
+	}
+
+	m := NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("r", "r2", "sub, tenant, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("p", "p2", "sub, tenant, act, eft")
+	m.AddDef("g", "g", "_, _")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("e", "e2", "priority(p.eft) || deny")
+	m.AddDef("m", "m", "g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act")
+	m.AddDef("m", "m2", "g(r2.sub, p2.sub) && r2.tenant == p2.tenant && r2.act == p2.act")
+
+	expected := `[request_definition]
+r = sub, obj, act
+r2 = sub, tenant, act
+
+[policy_definition]
+p = sub, obj, act
+p2 = sub, tenant, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+e2 = priority(p.eft) || deny
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+m2 = g(r2.sub, p2.sub) && r2.tenant == p2.tenant && r2.act == p2.act
+`
+	if text := m.ToText(); text != expected {
+		t.Errorf("%s, supposed to be %s", text, expected)
+	}
+
+	path := filepath.Join(t.TempDir(), "model.conf")
+	if err := m.SaveModel(path); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := NewModelFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testModelEquals(t, path, m, m2)
+}
+
+func TestPredefined(t *testing.T) {
+	examples := map[string]string{
+		"acl":                      "basic_model.conf",
+		"acl_with_superuser":       "basic_with_root_model.conf",
+		"rbac":                     "rbac_model.conf",
+		"rbac_with_resource_roles": "rbac_with_resource_roles_model.conf",
+		"rbac_with_domains":        "rbac_with_domains_model.conf",
+		"rbac_with_deny":           "rbac_with_deny_model.conf",
+		"restful":                  "keymatch_model.conf",
+		"abac":                     "abac_model.conf",
+	}
+	for name, file := range examples {
+		m, err := Predefined(name)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		expected, _ := NewModelFromFile(filepath.Join("..", "examples", file))
+		testModelEquals(t, name, expected, m)
+	}
+
+	// Every call returns a new model.
+	m, _ := Predefined("rbac")
+	m.AddDef("m", "m", "r.sub == p.sub")
+	if m, _ := Predefined("rbac"); m["m"]["m"].Value == "r_sub == p_sub" {
+		t.Error("a change to a predefined model should not change the catalog")
+	}
+
+	if _, err := Predefined("unknown"); err == nil {
+		t.Error("an unknown model should return an error")
+	}
+}
+
+func TestRegisterModel(t *testing.T) {
+	text := `
+[request_definition]
+r = sub, obj
+
+[policy_definition]
+p = sub, obj
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && keyMatch2(r.obj, p.obj)`
+
+	if err := RegisterModel("test_keymatch2", text); err != nil {
+		t.Fatal(err)
+	}
+	if !IsPredefined("test_keymatch2") {
+		t.Error("the registered model should be in the catalog")
+	}
+	m, err := Predefined("test_keymatch2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := NewModelFromString(text)
+	testModelEquals(t, "test_keymatch2", expected, m)
+
+	if err := RegisterModel("test_keymatch2", text); err == nil {
+		t.Error("a name should not be registered twice")
+	}
+	if err := RegisterModel("rbac", text); err == nil {
+		t.Error("a built-in model should not be replaced")
+	}
+	if err := RegisterModel("test_invalid", strings.Replace(text, "p.obj", "p.object", 1)); err == nil {
+		t.Error("an invalid model should not be registered")
+	}
+	if IsPredefined("test_invalid") {
+		t.Error("an invalid model should not be in the catalog")
+	}
+}
+
+func TestPolicyMap(t *testing.T) {
+	m, err := NewModelFromFile(basicExample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range []string{"alice", "bob", "carol", "dave"} {
+		if !m.AddPolicy("p", "p", []string{sub, "data1", "read"}) {
+			t.Errorf("%s should be added", sub)
+		}
+	}
+	if m.AddPolicy("p", "p", []string{"bob", "data1", "read"}) {
+		t.Error("a rule should not be added twice")
+	}
+	if pos, ok := m.DeletePolicy("p", "p", []string{"bob", "data1", "read"}); !ok || pos != 1 {
+		t.Errorf("DeletePolicy: %d, %t, supposed to be 1, true", pos, ok)
+	}
+	if m.HasPolicy("p", "p", []string{"bob", "data1", "read"}) {
+		t.Error("bob should be removed")
+	}
+	// The following rules keep their order and can still be found.
+	if pos, ok := m.DeletePolicy("p", "p", []string{"dave", "data1", "read"}); !ok || pos != 2 {
+		t.Errorf("DeletePolicy: %d, %t, supposed to be 2, true", pos, ok)
+	}
+
+	// The rules appended like loaded rules are found too.
+	ast := m["p"]["p"]
+	m.AppendPolicy("p", "p", []string{"eve", "data2", "write"})
+	m.AppendPolicy("p", "p", []string{"alice", "data1", "read"})
+	if !m.HasPolicy("p", "p", []string{"eve", "data2", "write"}) {
+		t.Error("eve should be found")
+	}
+	if m.AddPolicy("p", "p", []string{"eve", "data2", "write"}) {
+		t.Error("eve should not be added twice")
+	}
+	// The duplicated rules are kept, like when they are loaded, and removed one at a time.
+	if len(ast.Policy) != 4 {
+		t.Errorf("unexpected policy: %v", ast.Policy)
+	}
+	if pos, ok := m.DeletePolicy("p", "p", []string{"alice", "data1", "read"}); !ok || pos != 0 {
+		t.Errorf("DeletePolicy: %d, %t, supposed to be 0, true", pos, ok)
+	}
+	if pos, ok := m.DeletePolicy("p", "p", []string{"alice", "data1", "read"}); !ok || pos != 2 {
+		t.Errorf("DeletePolicy: %d, %t, supposed to be 2, true", pos, ok)
+	}
+	if m.HasPolicy("p", "p", []string{"alice", "data1", "read"}) {
+		t.Error("alice should be removed")
+	}
+
+	// SetPolicy indexes the rules it puts back.
+	m.SetPolicy("p", "p", [][]string{{"bob", "data1", "read"}, {"carol", "data1", "read"}})
+	if !m.HasPolicy("p", "p", []string{"bob", "data1", "read"}) || m.HasPolicy("p", "p", []string{"eve", "data2", "write"}) {
+		t.Errorf("unexpected policy: %v", ast.Policy)
+	}
+
+	// A rule changed directly is found once the policies are indexed again.
+	generation := ast.Generation()
+	ast.Policy[0] = []string{"dave", "data1", "read"}
+	m.IndexPolicies()
+	if !m.HasPolicy("p", "p", []string{"dave", "data1", "read"}) || m.HasPolicy("p", "p", []string{"bob", "data1", "read"}) {
+		t.Errorf("unexpected policy: %v", ast.Policy)
+	}
+	if ast.Generation() == generation {
+		t.Error("the generation should change when the policies are indexed again")
+	}
+
+	// Every change of the rules changes the generation.
+	for _, change := range []func(){
+		func() { m.AddPolicy("p", "p", []string{"eve", "data2", "write"}) },
+		func() { m.UpdatePolicy("p", "p", []string{"eve", "data2", "write"}, []string{"eve", "data2", "read"}) },
+		func() { m.RemovePolicy("p", "p", []string{"eve", "data2", "read"}) },
+		func() { m.RemoveFilteredPolicy("p", "p", 0, "carol") },
+		func() { m.ClearPolicy() },
+	} {
+		generation = ast.Generation()
+		change()
+		if ast.Generation() == generation {
+			t.Errorf("the generation did not change with the policy %v", ast.Policy)
+		}
+	}
+}
@@ -15,14 +15,23 @@
 package model
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+
 	"github.com/casbin/casbin/v2/log"
 	"github.com/casbin/casbin/v2/rbac"
 	"github.com/casbin/casbin/v2/util"
 )
 
 // BuildRoleLinks initializes the roles in RBAC.
-func (model Model) BuildRoleLinks(rm rbac.RoleManager) error {
-	for _, ast := range model["g"] {
+// Every grouping type gets the links of its own rules in its own role manager from rmMap.
+func (model Model) BuildRoleLinks(rmMap map[string]rbac.RoleManager) error {
+	for ptype, ast := range model["g"] {
+		rm, ok := rmMap[ptype]
+		if !ok {
+			return fmt.Errorf("no role manager for grouping type: %s", ptype)
+		}
 		err := ast.buildRoleLinks(rm)
 		if err != nil {
 			return err
@@ -48,13 +57,44 @@ func (model Model) PrintPolicy() {
 func (model Model) ClearPolicy() {
 	for _, ast := range model["p"] {
 		ast.Policy = nil
+		ast.policyEntries = nil
+		ast.policyMap = nil
+		ast.changed()
 	}
 
 	for _, ast := range model["g"] {
 		ast.Policy = nil
+		ast.policyEntries = nil
+		ast.policyMap = nil
+		ast.changed()
 	}
 }
 
+// IndexPolicies indexes the rules of all the policies again, so that they are found in constant time.
+// It must be called after the rules of Policy are changed directly instead of with the methods of the model,
+// e.g. by an adapter appending the loaded rules to Policy.
+func (model Model) IndexPolicies() {
+	for _, sec := range []string{"p", "g"} {
+		for _, ast := range model[sec] {
+			ast.buildPolicyMap()
+		}
+	}
+}
+
+// AppendPolicy appends a rule to a policy even if it already exists, like a loaded rule.
+func (model Model) AppendPolicy(sec string, ptype string, rule []string) {
+	ast := model[sec][ptype]
+	ast.updatePolicyMap()
+	ast.insertRule(len(ast.Policy), rule)
+}
+
+// SetPolicy replaces all the rules of a policy, e.g. to restore them after a failed change.
+func (model Model) SetPolicy(sec string, ptype string, rules [][]string) {
+	ast := model[sec][ptype]
+	ast.Policy = rules
+	ast.buildPolicyMap()
+}
+
 // GetPolicy gets all rules in a policy.
 func (model Model) GetPolicy(sec string, ptype string) [][]string {
 	return model[sec][ptype].Policy
@@ -82,35 +122,223 @@ func (model Model) GetFilteredPolicy(sec string, ptype string, fieldIndex int, f
 }
 
 // HasPolicy determines whether a model has the specified policy rule.
+// The rules are looked up by their key in a hash index, so it takes a constant time.
 func (model Model) HasPolicy(sec string, ptype string, rule []string) bool {
-	for _, r := range model[sec][ptype].Policy {
-		if util.ArrayEquals(rule, r) {
-			return true
+	return model[sec][ptype].position(rule) != -1
+}
+
+// AddPolicy adds a policy rule to the model.
+func (model Model) AddPolicy(sec string, ptype string, rule []string) bool {
+	_, ok := model.InsertPolicy(sec, ptype, rule)
+	return ok
+}
+
+// InsertPolicy adds a policy rule to the model and returns its position in the policy.
+// The rule is appended, unless the policy has a priority token, then it is inserted after
+// the rules with the same or a higher priority.
+func (model Model) InsertPolicy(sec string, ptype string, rule []string) (int, bool) {
+	ast := model[sec][ptype]
+	ast.updatePolicyMap()
+	if ast.position(rule) != -1 {
+		return -1, false
+	}
+
+	pos := len(ast.Policy)
+	if i := ast.priorityIndex(); i != -1 {
+		if priority, err := parsePriority(rule, i); err == nil {
+			pos = sort.Search(len(ast.Policy), func(j int) bool {
+				p, err := parsePriority(ast.Policy[j], i)
+				return err == nil && p > priority
+			})
 		}
 	}
 
-	return false
+	ast.insertRule(pos, rule)
+	return pos, true
 }
 
-// AddPolicy adds a policy rule to the model.
-func (model Model) AddPolicy(sec string, ptype string, rule []string) bool {
-	if !model.HasPolicy(sec, ptype, rule) {
-		model[sec][ptype].Policy = append(model[sec][ptype].Policy, rule)
-		return true
+// AddPolicies adds policy rules to the model.
+// The rules are added only if none of them is in the policy and they are all different,
+// otherwise the model is not changed and the function returns false.
+func (model Model) AddPolicies(sec string, ptype string, rules [][]string) bool {
+	ast := model[sec][ptype]
+	ast.updatePolicyMap()
+	keys := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		key := policyKey(rule)
+		if keys[key] || ast.position(rule) != -1 {
+			return false
+		}
+		keys[key] = true
 	}
-	return false
+
+	for _, rule := range rules {
+		model.InsertPolicy(sec, ptype, rule)
+	}
+	return true
+}
+
+// UpdatePolicy replaces a policy rule of the model by a new one, the new rule takes the position of the old one.
+// If the old rule does not exist or the new one already exists, the function returns false.
+func (model Model) UpdatePolicy(sec string, ptype string, oldRule []string, newRule []string) bool {
+	return model.UpdatePolicies(sec, ptype, [][]string{oldRule}, [][]string{newRule})
+}
+
+// UpdatePolicies replaces policy rules of the model by new ones, every new rule takes the position of its old rule.
+// The rules are replaced only if all the old rules exist and none of the new rules exist, unless it replaces
+// itself, otherwise the model is not changed and the function returns false.
+// A rule whose priority changes is moved after the rules with the same or a higher priority.
+func (model Model) UpdatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) bool {
+	if len(oldRules) != len(newRules) {
+		return false
+	}
+
+	ast := model[sec][ptype]
+	ast.updatePolicyMap()
+	oldKeys := make(map[string]bool, len(oldRules))
+	for _, rule := range oldRules {
+		key := policyKey(rule)
+		if oldKeys[key] || ast.position(rule) == -1 {
+			return false
+		}
+		oldKeys[key] = true
+	}
+	newKeys := make(map[string]bool, len(newRules))
+	for _, rule := range newRules {
+		key := policyKey(rule)
+		if newKeys[key] || !oldKeys[key] && ast.position(rule) != -1 {
+			return false
+		}
+		newKeys[key] = true
+	}
+
+	// The old rules are all removed from the index first, so that the rules can be swapped.
+	positions := make([]int, len(oldRules))
+	for i, rule := range oldRules {
+		positions[i] = ast.position(rule)
+	}
+	for _, pos := range positions {
+		ast.unlink(ast.policyEntries[pos])
+	}
+	for i, pos := range positions {
+		ast.replaceRule(pos, newRules[i])
+	}
+
+	if i := ast.priorityIndex(); i != -1 {
+		for j, rule := range oldRules {
+			oldPriority, err1 := parsePriority(rule, i)
+			newPriority, err2 := parsePriority(newRules[j], i)
+			if err1 == nil && err2 == nil && oldPriority != newPriority {
+				model.DeletePolicy(sec, ptype, newRules[j])
+				model.InsertPolicy(sec, ptype, newRules[j])
+			}
+		}
+	}
+	return true
+}
+
+// CheckPriority checks that the priority of a policy rule is an integer, if the policy has a priority token.
+func (model Model) CheckPriority(sec string, ptype string, rule []string) error {
+	i := model[sec][ptype].priorityIndex()
+	if i == -1 {
+		return nil
+	}
+	_, err := parsePriority(rule, i)
+	return err
+}
+
+// SortPoliciesByPriority sorts the rules of the policies having a priority token by ascending priority,
+// i.e. the rule with the lowest value comes first. The rules of the same priority keep their order.
+func (model Model) SortPoliciesByPriority() error {
+	for _, ast := range model["p"] {
+		i := ast.priorityIndex()
+		if i == -1 {
+			continue
+		}
+
+		priorities := make([]int, len(ast.Policy))
+		order := make([]int, len(ast.Policy))
+		for j, rule := range ast.Policy {
+			priority, err := parsePriority(rule, i)
+			if err != nil {
+				return err
+			}
+			priorities[j] = priority
+			order[j] = j
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return priorities[order[a]] < priorities[order[b]]
+		})
+
+		policy := make([][]string, len(order))
+		for j, k := range order {
+			policy[j] = ast.Policy[k]
+		}
+		ast.Policy = policy
+		ast.buildPolicyMap()
+	}
+
+	return nil
+}
+
+// priorityIndex returns the index of the priority token of the policy, or -1 if there is none.
+func (ast *Assertion) priorityIndex() int {
+	for i, token := range ast.Tokens {
+		if token == ast.Key+"_priority" {
+			return i
+		}
+	}
+	return -1
+}
+
+func parsePriority(rule []string, i int) (int, error) {
+	if i >= len(rule) {
+		return 0, fmt.Errorf("missing priority in policy rule: %v", rule)
+	}
+	priority, err := strconv.Atoi(rule[i])
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q in policy rule: %v", rule[i], rule)
+	}
+	return priority, nil
 }
 
 // RemovePolicy removes a policy rule from the model.
 func (model Model) RemovePolicy(sec string, ptype string, rule []string) bool {
-	for i, r := range model[sec][ptype].Policy {
-		if util.ArrayEquals(rule, r) {
-			model[sec][ptype].Policy = append(model[sec][ptype].Policy[:i], model[sec][ptype].Policy[i+1:]...)
-			return true
+	_, ok := model.DeletePolicy(sec, ptype, rule)
+	return ok
+}
+
+// DeletePolicy removes a policy rule from the model and returns the position it had in the policy.
+// The rule is found in constant time, the following rules keep their order.
+func (model Model) DeletePolicy(sec string, ptype string, rule []string) (int, bool) {
+	ast := model[sec][ptype]
+	ast.updatePolicyMap()
+	pos := ast.position(rule)
+	if pos == -1 {
+		return -1, false
+	}
+
+	ast.removeRule(pos)
+	return pos, true
+}
+
+// RemovePolicies removes policy rules from the model.
+// The rules are removed only if they are all in the policy and they are all different,
+// otherwise the model is not changed and the function returns false.
+func (model Model) RemovePolicies(sec string, ptype string, rules [][]string) bool {
+	ast := model[sec][ptype]
+	ast.updatePolicyMap()
+	positions := make(map[int]bool, len(rules))
+	for _, rule := range rules {
+		pos := ast.position(rule)
+		if pos == -1 || positions[pos] {
+			return false
 		}
+		positions[pos] = true
 	}
 
-	return false
+	ast.removeRules(positions)
+	return true
 }
 
 // RemoveFilteredPolicy removes policy rules based on field filters from the model.
@@ -134,6 +362,7 @@ func (model Model) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int
 	}
 
 	model[sec][ptype].Policy = tmp
+	model[sec][ptype].buildPolicyMap()
 	return res
 }
 
@@ -0,0 +1,199 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// The models of the catalog, they are the ones of the examples.
+var predefinedModels = map[string]string{
+	"acl": `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act
+`,
+	"acl_with_superuser": `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act || r.sub == "root"
+`,
+	"rbac": `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`,
+	"rbac_with_resource_roles": `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && g2(r.obj, p.obj) && r.act == p.act
+`,
+	"rbac_with_domains": `[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj && r.act == p.act
+`,
+	"rbac_with_deny": `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`,
+	"restful": `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && keyMatch(r.obj, p.obj) && regexMatch(r.act, p.act)
+`,
+	"abac": `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == r.obj.Owner
+`,
+}
+
+var predefinedMutex sync.RWMutex
+
+// Predefined returns a new model of the catalog by name. The built-in models are:
+//
+//	acl                       access control lists
+//	acl_with_superuser        access control lists with a "root" superuser
+//	rbac                      role-based access control
+//	rbac_with_resource_roles  role-based access control with roles of resources (g2)
+//	rbac_with_domains         role-based access control with roles per domain
+//	rbac_with_deny            role-based access control with deny rules overriding allow rules
+//	restful                   keyMatch paths and regexMatch methods of RESTful APIs
+//	abac                      attribute-based access control
+//
+// More models can be added with RegisterModel.
+func Predefined(name string) (Model, error) {
+	predefinedMutex.RLock()
+	text, ok := predefinedModels[name]
+	predefinedMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown predefined model: %s", name)
+	}
+
+	return NewModelFromString(text)
+}
+
+// IsPredefined determines whether a model of the catalog has the name.
+func IsPredefined(name string) bool {
+	predefinedMutex.RLock()
+	defer predefinedMutex.RUnlock()
+	_, ok := predefinedModels[name]
+	return ok
+}
+
+// PredefinedNames returns the sorted names of the models of the catalog.
+func PredefinedNames() []string {
+	predefinedMutex.RLock()
+	defer predefinedMutex.RUnlock()
+	names := make([]string, 0, len(predefinedModels))
+	for name := range predefinedModels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterModel adds the model text to the catalog under name, so that Predefined and NewEnforcer
+// know it. The model is checked first, and a name can not be registered twice.
+func RegisterModel(name string, text string) error {
+	m, err := NewModelFromString(text)
+	if err != nil {
+		return err
+	}
+	if err := m.Validate(nil); err != nil {
+		return err
+	}
+
+	predefinedMutex.Lock()
+	defer predefinedMutex.Unlock()
+	if _, ok := predefinedModels[name]; ok {
+		return fmt.Errorf("predefined model already registered: %s", name)
+	}
+	predefinedModels[name] = text
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keywords of the matcher expressions that look like identifiers.
+var matcherKeywords = map[string]bool{
+	"true":  true,
+	"false": true,
+	"in":    true,
+}
+
+// Validate checks the model for mistakes that would otherwise only fail at the first enforcement:
+// the matchers may only reference the tokens of the request and policy definitions, call the role
+// definitions with as many arguments as they have "_" and call the functions of fm.
+// The functions are not checked when fm is nil, e.g. before the custom functions are added.
+func (model Model) Validate(fm FunctionMap) error {
+	for _, key := range model.sortedKeys("g") {
+		if strings.Count(model["g"][key].Value, "_") < 2 {
+			return fmt.Errorf("invalid %s::%s: the number of \"_\" in role definition should be at least 2",
+				sectionNameMap["g"], key)
+		}
+	}
+
+	for _, key := range model.sortedKeys("m") {
+		if err := model.validateMatcher(key, fm); err != nil {
+			return fmt.Errorf("invalid %s::%s: %s", sectionNameMap["m"], key, err)
+		}
+	}
+
+	return nil
+}
+
+func (model Model) sortedKeys(sec string) []string {
+	keys := make([]string, 0, len(model[sec]))
+	for key := range model[sec] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || c >= '0' && c <= '9' || c == '.'
+}
+
+func (model Model) validateMatcher(key string, fm FunctionMap) error {
+	text := model["m"][key].Value
+	return scanMatcher(text, func(name string, open int) error {
+		if open != -1 {
+			return model.validateCall(name, countArguments(text[open+1:]), fm)
+		}
+		return model.validateIdentifier(name)
+	})
+}
+
+// Call is a call of a function in a matcher, Open is the position of its opening parenthesis.
+type Call struct {
+	Name      string
+	Open      int
+	Arguments int
+}
+
+// GetCalls returns the calls of functions in the matcher in order, the text of its strings is skipped.
+func GetCalls(matcher string) ([]Call, error) {
+	var calls []Call
+	err := scanMatcher(matcher, func(name string, open int) error {
+		if open != -1 {
+			calls = append(calls, Call{Name: name, Open: open, Arguments: countArguments(matcher[open+1:])})
+		}
+		return nil
+	})
+	return calls, err
+}
+
+// scanMatcher calls visit for the identifiers of the matcher outside its strings, open is the position
+// of the opening parenthesis if the identifier is the name of a called function, else -1.
+func scanMatcher(text string, visit func(name string, open int) error) error {
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(text[i+1:], c)
+			if end == -1 {
+				return fmt.Errorf("unterminated string at position %d", i)
+			}
+			i += end + 2
+		case c >= '0' && c <= '9':
+			for i < len(text) && isIdentifierChar(text[i]) {
+				i++
+			}
+		case isIdentifierStart(c):
+			start := i
+			for i < len(text) && isIdentifierChar(text[i]) {
+				i++
+			}
+			name := text[start:i]
+			if matcherKeywords[name] {
+				continue
+			}
+
+			j := i
+			for j < len(text) && text[j] == ' ' {
+				j++
+			}
+			open := -1
+			if j < len(text) && text[j] == '(' && !strings.Contains(name, ".") {
+				open = j
+			}
+			if err := visit(name, open); err != nil {
+				return err
+			}
+		default:
+			i++
+		}
+	}
+
+	return nil
+}
+
+// validateIdentifier checks that a token like "r_sub" or "p2_obj.Owner" is defined.
+func (model Model) validateIdentifier(name string) error {
+	token := name
+	if i := strings.IndexByte(token, '.'); i != -1 {
+		token = token[:i]
+	}
+	i := strings.IndexByte(token, '_')
+	if i == -1 {
+		return fmt.Errorf("unknown identifier %q", unescapeToken(name))
+	}
+
+	key := token[:i]
+	sec := key[:1]
+	if sec != "r" && sec != "p" || strings.Trim(key[1:], "0123456789") != "" {
+		return fmt.Errorf("unknown identifier %q", unescapeToken(name))
+	}
+	ast, ok := model[sec][key]
+	if !ok {
+		return fmt.Errorf("%q references %s::%s which is not defined", unescapeToken(name), sectionNameMap[sec], key)
+	}
+	for _, t := range ast.Tokens {
+		if t == token {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not defined in %s::%s", unescapeToken(token), sectionNameMap[sec], key)
+}
+
+// validateCall checks a call of a role definition or of a function.
+func (model Model) validateCall(name string, arguments int, fm FunctionMap) error {
+	if ast, ok := model["g"][name]; ok {
+		expected := strings.Count(ast.Value, "_")
+		if arguments != expected {
+			return fmt.Errorf("%s of %s expects %d arguments, got %d", name, sectionNameMap["g"], expected, arguments)
+		}
+		return nil
+	}
+
+	if fm == nil {
+		return nil
+	}
+	if _, ok := fm[name]; !ok {
+		return fmt.Errorf("function %q is not defined", name)
+	}
+	return nil
+}
+
+// countArguments counts the arguments of a call, text starts after the opening parenthesis.
+func countArguments(text string) int {
+	arguments, depth := 0, 0
+	empty := true
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch c {
+		case '\'', '"', '`':
+			if end := strings.IndexByte(text[i+1:], c); end != -1 {
+				i += end + 1
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				if empty {
+					return 0
+				}
+				return arguments + 1
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				arguments++
+			}
+		}
+		if c != ' ' && c != ')' {
+			empty = false
+		}
+	}
+	return arguments + 1
+}
+
+// unescapeToken turns a token like "r_sub" back into "r.sub" for the error messages.
+func unescapeToken(token string) string {
+	return strings.Replace(token, "_", ".", 1)
+}
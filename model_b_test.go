@@ -167,3 +167,22 @@ func BenchmarkPriorityModel(b *testing.B) {
 		e.Enforce("alice", "data1", "read")
 	}
 }
+
+func BenchmarkRemovePolicyLarge(b *testing.B) {
+	e, _ := NewEnforcer("examples/basic_model.conf")
+	// 100000 rules.
+	rules := make([][]string, 100000)
+	for i := range rules {
+		rules[i] = []string{fmt.Sprintf("user%d", i), fmt.Sprintf("data%d", i/10), "read"}
+	}
+	e.AddPolicies(rules)
+	e.Enforce("user501", "data50", "read")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Remove the first rule and add it back at the end, so that all the rules are shifted.
+		rule := e.GetPolicy()[0]
+		e.RemovePolicy(rule)
+		e.AddPolicy(rule)
+	}
+}
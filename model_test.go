@@ -15,8 +15,12 @@
 package casbin
 
 import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist/file-adapter"
 	"github.com/casbin/casbin/v2/rbac"
 	"github.com/casbin/casbin/v2/rbac/default-role-manager"
@@ -148,6 +152,33 @@ func TestRBACModelWithResourceRoles(t *testing.T) {
 	testEnforce(t, e, "bob", "data2", "write", true)
 }
 
+func TestRBACModelWithSeparateRoleManagers(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_resource_roles_model.conf", "examples/rbac_with_resource_roles_policy.csv")
+
+	if res, _ := e.GetNamedRoleManager("g2").HasLink("data1", "data_group"); !res {
+		t.Error("data1 should be in data_group with g2")
+	}
+	if res, _ := e.GetRoleManager().HasLink("data1", "data_group"); res {
+		t.Error("resource links of g2 should not be in the role manager of g")
+	}
+
+	// A subject named like a resource must not inherit the resource groups.
+	e.AddPolicy("data_group", "data1", "read")
+	testEnforce(t, e, "data1", "data1", "read", false)
+
+	rm := defaultrolemanager.NewRoleManager(10)
+	e.SetNamedRoleManager("g2", rm)
+	if e.GetNamedRoleManager("g2") != rm {
+		t.Error("the role manager of g2 should be replaced")
+	}
+	e.BuildRoleLinks()
+	testEnforce(t, e, "alice", "data1", "write", true)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	rm.DeleteLink("data2", "data_group")
+	testEnforce(t, e, "alice", "data1", "write", true)
+	testEnforce(t, e, "alice", "data2", "write", false)
+}
+
 func TestRBACModelWithDomains(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
 
@@ -243,6 +274,56 @@ func TestRBACModelWithOnlyDeny(t *testing.T) {
 	testEnforce(t, e, "alice", "data2", "write", false)
 }
 
+func TestRBACModelWithRuleCombiningAlgorithms(t *testing.T) {
+	text := `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = %s
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act`
+
+	// alice is allowed to write data2 as a data2_admin but denied as herself.
+	testCases := []struct {
+		algorithm string
+		res       bool
+		rule      []string
+	}{
+		{"deny-overrides", false, []string{"alice", "data2", "write", "deny"}},
+		{"permit-overrides", true, []string{"data2_admin", "data2", "write", "allow"}},
+		{"first-applicable", true, []string{"data2_admin", "data2", "write", "allow"}},
+		{"only-one-applicable", false, nil},
+		{"deny-unless-permit", true, []string{"data2_admin", "data2", "write", "allow"}},
+		{"permit-unless-deny", false, []string{"alice", "data2", "write", "deny"}},
+	}
+	for _, tc := range testCases {
+		m, err := model.NewModelFromString(fmt.Sprintf(text, tc.algorithm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/rbac_with_deny_policy.csv"))
+
+		res, explain, err := e.EnforceEx("alice", "data2", "write")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != tc.res || !util.ArrayEquals(explain.Rule, tc.rule) {
+			t.Errorf("%s: %t, %v, supposed to be %t, %v", tc.algorithm, res, explain.Rule, tc.res, tc.rule)
+		}
+
+		testEnforce(t, e, "alice", "data1", "read", true)
+		testEnforce(t, e, "bob", "data1", "read", tc.algorithm == "permit-unless-deny")
+	}
+}
+
 func TestRBACModelWithCustomData(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
 
@@ -279,11 +360,11 @@ func TestRBACModelWithPattern(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
 
 	// Here's a little confusing: the matching function here is not the custom function used in matcher.
-	// It is the matching function used by "g" (and "g2", "g3" if any..)
+	// It is the matching function used by "g2", every grouping type has its own role manager.
 	// You can see in policy that: "g2, /book/:id, book_group", so in "g2()" function in the matcher, instead
 	// of checking whether "/book/:id" equals the obj: "/book/1", it checks whether the pattern matches.
 	// You can see it as normal RBAC: "/book/:id" == "/book/1" becomes KeyMatch2("/book/:id", "/book/1")
-	e.rm.(*defaultrolemanager.RoleManager).AddMatchingFunc("KeyMatch2", util.KeyMatch2)
+	e.GetNamedRoleManager("g2").(*defaultrolemanager.RoleManager).AddMatchingFunc("KeyMatch2", util.KeyMatch2)
 	testEnforce(t, e, "alice", "/book/1", "GET", true)
 	testEnforce(t, e, "alice", "/book/2", "GET", true)
 	testEnforce(t, e, "alice", "/pen/1", "GET", true)
@@ -295,7 +376,7 @@ func TestRBACModelWithPattern(t *testing.T) {
 
 	// AddMatchingFunc() is actually setting a function because only one function is allowed,
 	// so when we set "KeyMatch3", we are actually replacing "KeyMatch2" with "KeyMatch3".
-	e.rm.(*defaultrolemanager.RoleManager).AddMatchingFunc("KeyMatch3", util.KeyMatch3)
+	e.GetNamedRoleManager("g2").(*defaultrolemanager.RoleManager).AddMatchingFunc("KeyMatch3", util.KeyMatch3)
 	testEnforce(t, e, "alice", "/book2/1", "GET", true)
 	testEnforce(t, e, "alice", "/book2/2", "GET", true)
 	testEnforce(t, e, "alice", "/pen2/1", "GET", true)
@@ -484,6 +565,178 @@ func TestPriorityModelIndeterminate(t *testing.T) {
 	testEnforce(t, e, "alice", "data1", "read", false)
 }
 
+func TestExplicitPriorityModel(t *testing.T) {
+	e, err := NewEnforcer("examples/priority_model_explicit.conf", "examples/priority_policy_explicit.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rules are sorted by priority, the ones of the same priority keep their order.
+	testGetPolicy(t, e, [][]string{
+		{"1", "alice", "data1", "write", "allow"},
+		{"1", "alice", "data1", "read", "allow"},
+		{"1", "bob", "data2", "read", "deny"},
+		{"10", "data1_deny_group", "data1", "read", "deny"},
+		{"10", "data1_deny_group", "data1", "write", "deny"},
+		{"10", "data2_allow_group", "data2", "read", "allow"},
+		{"10", "data2_allow_group", "data2", "write", "allow"},
+	})
+
+	testEnforce(t, e, "alice", "data1", "write", true)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "read", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	testEnforce(t, e, "data1_deny_group", "data1", "read", false)
+	testEnforce(t, e, "data1_deny_group", "data1", "write", false)
+	testEnforce(t, e, "data2_allow_group", "data2", "read", true)
+	testEnforce(t, e, "data2_allow_group", "data2", "write", true)
+
+	// A new rule is inserted after the ones of the same priority, before the ones of a lower priority.
+	_, err = e.AddPolicy("1", "bob", "data2", "write", "deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "bob", "data2", "write", false)
+	_, err = e.AddPolicy("0", "alice", "data1", "write", "deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data1", "write", false)
+	testGetPolicy(t, e, [][]string{
+		{"0", "alice", "data1", "write", "deny"},
+		{"1", "alice", "data1", "write", "allow"},
+		{"1", "alice", "data1", "read", "allow"},
+		{"1", "bob", "data2", "read", "deny"},
+		{"1", "bob", "data2", "write", "deny"},
+		{"10", "data1_deny_group", "data1", "read", "deny"},
+		{"10", "data1_deny_group", "data1", "write", "deny"},
+		{"10", "data2_allow_group", "data2", "read", "allow"},
+		{"10", "data2_allow_group", "data2", "write", "allow"},
+	})
+
+	if _, err := e.AddPolicy("high", "bob", "data1", "read", "allow"); err == nil {
+		t.Error("a rule with an invalid priority should not be added")
+	}
+	testEnforce(t, e, "bob", "data1", "read", false)
+}
+
+func TestExplicitPriorityModelInvalidPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	if err := ioutil.WriteFile(path, []byte("p, 1, alice, data1, read, allow\np, first, bob, data2, read, allow\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewEnforcer("examples/priority_model_explicit.conf", path); err == nil {
+		t.Error("a policy with an invalid priority should not be loaded")
+	}
+
+	// The loaded policy is kept when loading another one fails.
+	if err := ioutil.WriteFile(path, []byte("p, 1, alice, data1, read, allow\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEnforcer("examples/priority_model_explicit.conf", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("p, 1, bob, data2, read, allow\np, first, bob, data2, read, allow\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.LoadPolicy(); err == nil {
+		t.Error("a policy with an invalid priority should not be loaded")
+	}
+	testGetPolicy(t, e, [][]string{{"1", "alice", "data1", "read", "allow"}})
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "read", false)
+}
+
+func TestSubjectPriorityModel(t *testing.T) {
+	e, err := NewEnforcer("examples/subject_priority_model.conf", "examples/subject_priority_policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testEnforce(t, e, "jane", "data1", "read", true)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "editor", "data1", "read", false)
+	testEnforce(t, e, "admin", "data1", "read", false)
+	testEnforce(t, e, "root", "data1", "read", false)
+	testEnforce(t, e, "bob", "data1", "read", false)
+
+	// The closest role with a rule decides: editor for jane, admin for alice.
+	testEnforce(t, e, "jane", "data2", "write", false)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testEnforce(t, e, "root", "data2", "write", true)
+
+	testCases := []struct {
+		sub  string
+		obj  string
+		act  string
+		rule []string
+	}{
+		{"jane", "data1", "read", []string{"jane", "data1", "read", "allow"}},
+		{"jane", "data2", "write", []string{"editor", "data2", "write", "deny"}},
+		{"alice", "data2", "write", []string{"admin", "data2", "write", "allow"}},
+		{"bob", "data2", "write", nil},
+	}
+	for _, tc := range testCases {
+		_, explain, err := e.EnforceEx(tc.sub, tc.obj, tc.act)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !util.ArrayEquals(explain.Rule, tc.rule) {
+			t.Errorf("%s, %s, %s: %v, supposed to be %v", tc.sub, tc.obj, tc.act, explain.Rule, tc.rule)
+		}
+	}
+}
+
+func TestSubjectPriorityModelWithOtherRoleDefinition(t *testing.T) {
+	m, err := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+g2 = _, _
+
+[policy_effect]
+e = subjectPriority(p.eft) || deny
+
+[matchers]
+m = g2(r.sub, p.sub) && g(r.obj, p.obj) && r.act == p.act
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEnforcer(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = e.AddPolicies([][]string{
+		{"admin", "data1", "read", "allow"},
+		{"editor", "data1", "read", "deny"},
+	})
+	_, _ = e.AddNamedGroupingPolicies("g2", [][]string{{"jane", "editor"}, {"editor", "admin"}})
+
+	// The roles of the subject are the ones of g2, editor is closer to jane than admin.
+	testEnforce(t, e, "jane", "data1", "read", false)
+	testEnforce(t, e, "admin", "data1", "read", true)
+}
+
+func TestSubjectPriorityModelWithDomain(t *testing.T) {
+	e, err := NewEnforcer("examples/subject_priority_model_with_domain.conf", "examples/subject_priority_policy_with_domain.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "write", true)
+	testDomainEnforce(t, e, "bob", "domain1", "data1", "write", false)
+	testDomainEnforce(t, e, "alice", "domain2", "data2", "write", false)
+	testDomainEnforce(t, e, "bob", "domain2", "data2", "write", true)
+}
+
 func TestRBACModelInMultiLines(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model_in_multi_line.conf", "examples/rbac_policy.csv")
 
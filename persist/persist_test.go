@@ -7,3 +7,21 @@ import (
 func TestPersist(t *testing.T) {
 	//No tests yet
 }
+
+func TestWatcherMessage(t *testing.T) {
+	m := &WatcherMessage{Method: UpdateForAddPolicy, Sender: "node1", Seq: 3, Sec: "p", PType: "p",
+		Params: []string{"alice", "data1", "read"}}
+	parsed, err := ParseWatcherMessage(m.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.String() != m.String() {
+		t.Errorf("%s, supposed to be %s", parsed, m)
+	}
+
+	for _, s := range []string{"", "update", `{"sender": "node1"}`} {
+		if _, err := ParseWatcherMessage(s); err == nil {
+			t.Errorf("%q should not be a watcher message", s)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persist
+
+// TransactionalAdapter is the interface for Casbin adapters supporting transactions.
+type TransactionalAdapter interface {
+	Adapter
+
+	// BeginTransaction starts a transaction in the storage.
+	BeginTransaction() (Transaction, error)
+}
+
+// Transaction is a transaction of a TransactionalAdapter,
+// the policy rules changed through it are only saved when it is committed.
+type Transaction interface {
+	// AddPolicy adds a policy rule to the storage.
+	AddPolicy(sec string, ptype string, rule []string) error
+	// RemovePolicy removes a policy rule from the storage.
+	RemovePolicy(sec string, ptype string, rule []string) error
+	// Commit saves the changes of the transaction.
+	Commit() error
+	// Rollback discards the changes of the transaction.
+	Rollback() error
+}
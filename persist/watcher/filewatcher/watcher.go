@@ -0,0 +1,246 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filewatcher implements a watcher reloading the policy when the policy file changes,
+// e.g. the file of the file adapter edited by hand or by a configuration management tool.
+package filewatcher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// Watcher is the file watcher for Casbin. It polls the modification time and the size of the file,
+// and calls the update callback when the hash of its content changed. It uses no OS notification,
+// so a change keeping both the modification time and the size is only seen with the next change.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	debounce time.Duration
+
+	mutex    sync.Mutex
+	callback func(string)
+	// The state of the file when the callback was last called, or when the enforcer last saved the policy.
+	modTime time.Time
+	size    int64
+	hash    []byte
+	// The state of the file changing since changedAt, the callback is called when it is stable.
+	pendingModTime time.Time
+	pendingSize    int64
+	changedAt      time.Time
+
+	stop   chan struct{}
+	closed bool
+}
+
+// NewWatcher is the constructor for Watcher. The file at path is checked every interval,
+// a change is notified once the file has not changed for another interval.
+func NewWatcher(path string, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, errors.New("the interval of the file watcher must be positive")
+	}
+
+	w := &Watcher{
+		path:     path,
+		interval: interval,
+		debounce: interval,
+		stop:     make(chan struct{}),
+	}
+	if err := w.reset(); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// SetDebounce sets how long the file must not change before the change is notified,
+// so that the callback is called once for a burst of writes.
+func (w *Watcher) SetDebounce(debounce time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.debounce = debounce
+}
+
+// SetUpdateCallback sets the callback function that the watcher will call when the file changed.
+// A classic callback is Enforcer.LoadPolicy().
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update is called after the enforcer changed its policy. The change is not written to the file,
+// the file is still reloaded when it changes.
+func (w *Watcher) Update() error {
+	return w.checkOpen()
+}
+
+// UpdateForAddPolicy is called after the enforcer added a policy rule, see Update().
+func (w *Watcher) UpdateForAddPolicy(sec string, ptype string, params ...string) error {
+	return w.checkOpen()
+}
+
+// UpdateForRemovePolicy is called after the enforcer removed a policy rule, see Update().
+func (w *Watcher) UpdateForRemovePolicy(sec string, ptype string, params ...string) error {
+	return w.checkOpen()
+}
+
+// UpdateForRemoveFilteredPolicy is called after the enforcer removed the policy rules matching
+// the field filters, see Update().
+func (w *Watcher) UpdateForRemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.checkOpen()
+}
+
+// UpdateForAddPolicies is called after the enforcer added policy rules, see Update().
+func (w *Watcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return w.checkOpen()
+}
+
+// UpdateForRemovePolicies is called after the enforcer removed policy rules, see Update().
+func (w *Watcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return w.checkOpen()
+}
+
+// UpdateForUpdatePolicies is called after the enforcer replaced policy rules, see Update().
+func (w *Watcher) UpdateForUpdatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) error {
+	return w.checkOpen()
+}
+
+// UpdateForSavePolicy is called after the enforcer saved the policy: the file it just wrote is
+// recorded as the current state, so that the enforcer does not reload the policy it saved.
+func (w *Watcher) UpdateForSavePolicy(model model.Model) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return errors.New("watcher is closed")
+	}
+	return w.reset()
+}
+
+// Close stops the watcher, the callback function will not be called any more.
+func (w *Watcher) Close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.stop)
+}
+
+func (w *Watcher) checkOpen() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return errors.New("watcher is closed")
+	}
+	return nil
+}
+
+// reset records the current state of the file, the watcher is locked.
+func (w *Watcher) reset() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	hash, err := hashFile(w.path)
+	if err != nil {
+		return err
+	}
+	w.modTime, w.size, w.hash = info.ModTime(), info.Size(), hash
+	w.changedAt = time.Time{}
+	return nil
+}
+
+func hashFile(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(content)
+	return hash[:], nil
+}
+
+func (w *Watcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			w.Poll(now)
+		}
+	}
+}
+
+// Poll checks the file as the watcher does every interval, now is the time of the check.
+// The callback is called before it returns if the change of the file is notified.
+// It is useful to check the file at once, or to drive the watcher with a long interval in tests.
+func (w *Watcher) Poll(now time.Time) {
+	if callback := w.check(now); callback != nil {
+		callback(w.path)
+	}
+}
+
+// check polls the file and returns the callback to call if its content changed.
+func (w *Watcher) check(now time.Time) func(string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+
+	// The file may be missing while it is replaced, it is checked again at the next poll.
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return nil
+	}
+	modTime, size := info.ModTime(), info.Size()
+
+	if w.changedAt.IsZero() {
+		if modTime.Equal(w.modTime) && size == w.size {
+			return nil
+		}
+	} else if modTime.Equal(w.pendingModTime) && size == w.pendingSize {
+		if now.Sub(w.changedAt) < w.debounce {
+			return nil
+		}
+
+		w.changedAt = time.Time{}
+		hash, err := hashFile(w.path)
+		if err != nil {
+			return nil
+		}
+		changed := !bytes.Equal(hash, w.hash)
+		w.modTime, w.size, w.hash = modTime, size, hash
+		if !changed {
+			return nil
+		}
+		return w.callback
+	}
+
+	// The file is changing, wait until it is stable.
+	w.pendingModTime, w.pendingSize = modTime, size
+	w.changedAt = now
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filewatcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The watcher is driven by Poll(), the interval is long enough for its own polls to never happen.
+const interval = time.Hour
+
+// modTime is the modification time of the files written by the tests, every write advances it,
+// so that the changes are seen whatever the resolution of the file system.
+var modTime = time.Now().Add(-time.Hour)
+
+func newTestWatcher(t *testing.T) (*Watcher, string, *[]string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "casbin-filewatcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "policy.csv")
+	writeFile(t, path, "p, alice, data1, read\n")
+
+	w, err := NewWatcher(path, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := &[]string{}
+	_ = w.SetUpdateCallback(func(msg string) { *updates = append(*updates, msg) })
+	return w, path, updates
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime = modTime.Add(time.Second)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pollUntilStable polls the file when it changed and once it has been stable for the debounce interval.
+func pollUntilStable(w *Watcher, now time.Time) {
+	w.Poll(now)
+	w.Poll(now.Add(interval))
+}
+
+func expectUpdates(t *testing.T, updates *[]string, n int) {
+	t.Helper()
+	if len(*updates) != n {
+		t.Errorf("%d updates, supposed to be %d", len(*updates), n)
+	}
+	*updates = nil
+}
+
+func TestWatcher(t *testing.T) {
+	w, path, updates := newTestWatcher(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer w.Close()
+	now := time.Now()
+
+	w.Poll(now)
+	expectUpdates(t, updates, 0)
+
+	writeFile(t, path, "p, alice, data1, read\np, bob, data2, write\n")
+	w.Poll(now)
+	w.Poll(now.Add(interval / 2))
+	expectUpdates(t, updates, 0)
+	w.Poll(now.Add(interval))
+	expectUpdates(t, updates, 1)
+
+	// The burst of writes is notified once.
+	now = now.Add(2 * interval)
+	for i := 0; i < 5; i++ {
+		writeFile(t, path, "p, alice, data1, read\n"+string(rune('a'+i))+"\n")
+		w.Poll(now.Add(time.Duration(i) * interval / 4))
+	}
+	expectUpdates(t, updates, 0)
+	w.Poll(now.Add(interval + interval/2))
+	expectUpdates(t, updates, 0)
+	w.Poll(now.Add(2 * interval))
+	expectUpdates(t, updates, 1)
+	w.Poll(now.Add(3 * interval))
+	expectUpdates(t, updates, 0)
+
+	// The same content is not notified.
+	now = now.Add(4 * interval)
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	pollUntilStable(w, now)
+	expectUpdates(t, updates, 0)
+}
+
+func TestWatcherIgnoresOwnWrites(t *testing.T) {
+	w, path, updates := newTestWatcher(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	now := time.Now()
+
+	// Like Enforcer.SavePolicy(), which calls UpdateForSavePolicy() after writing the file.
+	writeFile(t, path, "p, bob, data2, write\n")
+	if err := w.UpdateForSavePolicy(nil); err != nil {
+		t.Fatal(err)
+	}
+	pollUntilStable(w, now)
+	expectUpdates(t, updates, 0)
+
+	// The other changes of the enforcer do not hide the changes of the file.
+	now = now.Add(2 * interval)
+	writeFile(t, path, "p, carol, data3, read\n")
+	if err := w.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.UpdateForAddPolicy("p", "p", "eve", "data3", "read"); err != nil {
+		t.Fatal(err)
+	}
+	pollUntilStable(w, now)
+	expectUpdates(t, updates, 1)
+
+	w.Close()
+	now = now.Add(2 * interval)
+	writeFile(t, path, "p, alice, data1, read\n")
+	pollUntilStable(w, now)
+	expectUpdates(t, updates, 0)
+	if err := w.Update(); err == nil {
+		t.Error("a closed watcher should not be updated")
+	}
+	if err := w.UpdateForSavePolicy(nil); err == nil {
+		t.Error("a closed watcher should not be updated")
+	}
+}
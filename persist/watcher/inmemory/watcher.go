@@ -0,0 +1,249 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inmemory implements a watcher notifying the enforcers of the same process, e.g. several
+// SyncedEnforcers sharing an adapter, without an external message bus.
+package inmemory
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// Broker fans out the messages of its watchers: a message published by a watcher is delivered
+// to all the other watchers of the broker.
+type Broker struct {
+	mutex    sync.Mutex
+	watchers map[*Watcher]bool
+	count    int
+
+	// pending counts the messages not delivered yet, for Flush().
+	pending     int
+	pendingCond *sync.Cond
+}
+
+// NewBroker is the constructor for Broker.
+func NewBroker() *Broker {
+	b := &Broker{watchers: map[*Watcher]bool{}}
+	b.pendingCond = sync.NewCond(&b.mutex)
+	return b
+}
+
+// NewWatcher creates a watcher subscribed to the broker, it is given to one enforcer with SetWatcher().
+func (b *Broker) NewWatcher() *Watcher {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.count++
+	w := &Watcher{
+		broker: b,
+		id:     fmt.Sprintf("inmemory-%d", b.count),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	b.watchers[w] = true
+	go w.deliver()
+	return w
+}
+
+// Flush waits until the messages published so far are delivered to all the watchers,
+// i.e. until their callbacks returned.
+func (b *Broker) Flush() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for b.pending > 0 {
+		b.pendingCond.Wait()
+	}
+}
+
+// publish queues the message for all the watchers except the sender. The messages are queued while
+// the broker is locked, so every watcher receives the messages of all the senders in the same order.
+func (b *Broker) publish(sender *Watcher, m persist.WatcherMessage) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.watchers[sender] {
+		return errors.New("watcher is closed")
+	}
+	sender.seq++
+	m.Sender, m.Seq = sender.id, sender.seq
+	msg := m.String()
+	for w := range b.watchers {
+		if w == sender {
+			continue
+		}
+		w.queue = append(w.queue, msg)
+		b.pending++
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// delivered records that n messages were delivered or dropped, the broker is locked.
+func (b *Broker) delivered(n int) {
+	b.pending -= n
+	if b.pending == 0 {
+		b.pendingCond.Broadcast()
+	}
+}
+
+// Watcher is the in-memory watcher for Casbin. The messages are persist.WatcherMessage, so that the
+// other enforcers apply the changes of the policy without reloading it. A watcher never blocks the
+// enforcer publishing a message: every watcher queues its messages and calls its callback from its own
+// goroutine, one message at a time and in the order they were published.
+type Watcher struct {
+	broker   *Broker
+	id       string
+	seq      uint64
+	callback func(string)
+
+	// queue is guarded by the lock of the broker, notify signals that it is not empty.
+	queue  []string
+	notify chan struct{}
+	done   chan struct{}
+}
+
+// SetUpdateCallback sets the callback function that the watcher will call
+// when the policy has been changed by the other enforcers of the broker.
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.broker.mutex.Lock()
+	defer w.broker.mutex.Unlock()
+	w.callback = callback
+	return nil
+}
+
+func (w *Watcher) deliver() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.notify:
+		}
+
+		for {
+			w.broker.mutex.Lock()
+			if len(w.queue) == 0 || !w.broker.watchers[w] {
+				w.broker.mutex.Unlock()
+				break
+			}
+			msg := w.queue[0]
+			w.queue = w.queue[1:]
+			callback := w.callback
+			w.broker.mutex.Unlock()
+
+			if callback != nil {
+				callback(msg)
+			}
+
+			w.broker.mutex.Lock()
+			w.broker.delivered(1)
+			w.broker.mutex.Unlock()
+		}
+	}
+}
+
+// Update notifies the other enforcers to reload the whole policy.
+func (w *Watcher) Update() error {
+	return w.broker.publish(w, persist.WatcherMessage{Method: persist.Update})
+}
+
+// UpdateForAddPolicy notifies the other enforcers that a policy rule was added.
+func (w *Watcher) UpdateForAddPolicy(sec string, ptype string, params ...string) error {
+	return w.broker.publish(w, persist.WatcherMessage{
+		Method: persist.UpdateForAddPolicy,
+		Sec:    sec,
+		PType:  ptype,
+		Params: params,
+	})
+}
+
+// UpdateForRemovePolicy notifies the other enforcers that a policy rule was removed.
+func (w *Watcher) UpdateForRemovePolicy(sec string, ptype string, params ...string) error {
+	return w.broker.publish(w, persist.WatcherMessage{
+		Method: persist.UpdateForRemovePolicy,
+		Sec:    sec,
+		PType:  ptype,
+		Params: params,
+	})
+}
+
+// UpdateForRemoveFilteredPolicy notifies the other enforcers that the policy rules matching the field filters were removed.
+func (w *Watcher) UpdateForRemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.broker.publish(w, persist.WatcherMessage{
+		Method:     persist.UpdateForRemoveFilteredPolicy,
+		Sec:        sec,
+		PType:      ptype,
+		FieldIndex: fieldIndex,
+		Params:     fieldValues,
+	})
+}
+
+// UpdateForAddPolicies notifies the other enforcers that policy rules were added at once.
+func (w *Watcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return w.broker.publish(w, persist.WatcherMessage{
+		Method: persist.UpdateForAddPolicies,
+		Sec:    sec,
+		PType:  ptype,
+		Rules:  rules,
+	})
+}
+
+// UpdateForRemovePolicies notifies the other enforcers that policy rules were removed at once.
+func (w *Watcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return w.broker.publish(w, persist.WatcherMessage{
+		Method: persist.UpdateForRemovePolicies,
+		Sec:    sec,
+		PType:  ptype,
+		Rules:  rules,
+	})
+}
+
+// UpdateForUpdatePolicies notifies the other enforcers that policy rules were replaced.
+func (w *Watcher) UpdateForUpdatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) error {
+	return w.broker.publish(w, persist.WatcherMessage{
+		Method:   persist.UpdateForUpdatePolicies,
+		Sec:      sec,
+		PType:    ptype,
+		Rules:    oldRules,
+		NewRules: newRules,
+	})
+}
+
+// UpdateForSavePolicy notifies the other enforcers that the whole policy was saved, they reload it.
+func (w *Watcher) UpdateForSavePolicy(model model.Model) error {
+	return w.broker.publish(w, persist.WatcherMessage{Method: persist.UpdateForSavePolicy})
+}
+
+// Close unsubscribes the watcher from the broker and drops the messages it did not deliver yet.
+// The callback is not called any more, except for a call already in progress.
+// The watcher cannot publish messages after it is closed.
+func (w *Watcher) Close() {
+	w.broker.mutex.Lock()
+	defer w.broker.mutex.Unlock()
+
+	if !w.broker.watchers[w] {
+		return
+	}
+	delete(w.broker.watchers, w)
+	w.broker.delivered(len(w.queue))
+	w.queue = nil
+	close(w.done)
+}
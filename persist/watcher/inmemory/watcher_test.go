@@ -0,0 +1,113 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inmemory
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/casbin/casbin/v2/persist"
+)
+
+type receiver struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (r *receiver) callback(msg string) {
+	m, err := persist.ParseWatcherMessage(msg)
+	if err != nil {
+		panic(err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.messages = append(r.messages, fmt.Sprintf("%s:%d:%s:%v", m.Sender, m.Seq, m.Method, m.Params))
+}
+
+func (r *receiver) get() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.messages
+}
+
+func TestWatcher(t *testing.T) {
+	b := NewBroker()
+	w1, w2, w3 := b.NewWatcher(), b.NewWatcher(), b.NewWatcher()
+	r1, r2, r3 := &receiver{}, &receiver{}, &receiver{}
+	_ = w1.SetUpdateCallback(r1.callback)
+	_ = w2.SetUpdateCallback(r2.callback)
+	_ = w3.SetUpdateCallback(r3.callback)
+
+	_ = w1.UpdateForAddPolicy("p", "p", "alice", "data1", "read")
+	_ = w2.Update()
+	_ = w1.UpdateForRemovePolicy("p", "p", "alice", "data1", "read")
+	b.Flush()
+
+	// The watchers do not receive their own messages, the others receive them in order.
+	expected := []string{
+		"inmemory-2:1:Update:[]",
+	}
+	if messages := r1.get(); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("w1 received %v, supposed to be %v", messages, expected)
+	}
+	expected = []string{
+		"inmemory-1:1:UpdateForAddPolicy:[alice data1 read]",
+		"inmemory-1:2:UpdateForRemovePolicy:[alice data1 read]",
+	}
+	if messages := r2.get(); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("w2 received %v, supposed to be %v", messages, expected)
+	}
+	expected = []string{
+		"inmemory-1:1:UpdateForAddPolicy:[alice data1 read]",
+		"inmemory-2:1:Update:[]",
+		"inmemory-1:2:UpdateForRemovePolicy:[alice data1 read]",
+	}
+	if messages := r3.get(); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("w3 received %v, supposed to be %v", messages, expected)
+	}
+
+	// A closed watcher does not receive nor publish messages.
+	w3.Close()
+	w3.Close()
+	_ = w1.Update()
+	b.Flush()
+	if messages := r3.get(); len(messages) != 3 {
+		t.Errorf("w3 received %v after it was closed", messages[3:])
+	}
+	if err := w3.Update(); err == nil {
+		t.Error("a closed watcher should not publish messages")
+	}
+}
+
+func TestWatcherOrder(t *testing.T) {
+	b := NewBroker()
+	w1, w2 := b.NewWatcher(), b.NewWatcher()
+	r := &receiver{}
+	_ = w2.SetUpdateCallback(r.callback)
+
+	var expected []string
+	for i := 1; i <= 1000; i++ {
+		_ = w1.UpdateForAddPolicy("p", "p", fmt.Sprint(i))
+		expected = append(expected, fmt.Sprintf("inmemory-1:%d:UpdateForAddPolicy:[%d]", i, i))
+	}
+	b.Flush()
+	if messages := r.get(); !reflect.DeepEqual(messages, expected) {
+		t.Errorf("the messages were not received in order")
+	}
+	w1.Close()
+	w2.Close()
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persist
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// WatcherEx is the extended interface of the watchers. Instead of asking the other instances
+// to reload the whole policy, it tells them the change of the policy, as a WatcherMessage.
+type WatcherEx interface {
+	Watcher
+
+	// UpdateForAddPolicy notifies that a policy rule was added.
+	UpdateForAddPolicy(sec string, ptype string, params ...string) error
+	// UpdateForRemovePolicy notifies that a policy rule was removed.
+	UpdateForRemovePolicy(sec string, ptype string, params ...string) error
+	// UpdateForRemoveFilteredPolicy notifies that the policy rules matching the field filters were removed.
+	UpdateForRemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error
+	// UpdateForAddPolicies notifies that policy rules were added at once.
+	UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error
+	// UpdateForRemovePolicies notifies that policy rules were removed at once.
+	UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error
+	// UpdateForUpdatePolicies notifies that policy rules were replaced, oldRules[i] by newRules[i].
+	UpdateForUpdatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) error
+	// UpdateForSavePolicy notifies that the whole policy was saved.
+	UpdateForSavePolicy(model model.Model) error
+}
+
+// UpdateType is the change of the policy notified by a WatcherMessage.
+type UpdateType string
+
+// The changes of the policy notified by the watchers.
+const (
+	Update                        UpdateType = "Update"
+	UpdateForAddPolicy            UpdateType = "UpdateForAddPolicy"
+	UpdateForRemovePolicy         UpdateType = "UpdateForRemovePolicy"
+	UpdateForRemoveFilteredPolicy UpdateType = "UpdateForRemoveFilteredPolicy"
+	UpdateForAddPolicies          UpdateType = "UpdateForAddPolicies"
+	UpdateForRemovePolicies       UpdateType = "UpdateForRemovePolicies"
+	UpdateForUpdatePolicies       UpdateType = "UpdateForUpdatePolicies"
+	UpdateForSavePolicy           UpdateType = "UpdateForSavePolicy"
+)
+
+// WatcherMessage is the message a WatcherEx passes to the update callback of the other instances.
+// Sender identifies the instance that changed the policy, Seq numbers its messages from 1 without gaps,
+// so that the receivers can detect a missed message and reload the whole policy instead.
+type WatcherMessage struct {
+	Method     UpdateType `json:"method"`
+	Sender     string     `json:"sender"`
+	Seq        uint64     `json:"seq"`
+	Sec        string     `json:"sec,omitempty"`
+	PType      string     `json:"ptype,omitempty"`
+	FieldIndex int        `json:"fieldIndex,omitempty"`
+	Params     []string   `json:"params,omitempty"`
+	// Rules are the rules added, removed or replaced by the batch changes, NewRules replace Rules.
+	Rules    [][]string `json:"rules,omitempty"`
+	NewRules [][]string `json:"newRules,omitempty"`
+}
+
+// String returns the message encoded in JSON, as passed to the update callbacks.
+func (m *WatcherMessage) String() string {
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// ParseWatcherMessage decodes a message encoded by WatcherMessage.String().
+func ParseWatcherMessage(s string) (*WatcherMessage, error) {
+	m := &WatcherMessage{}
+	if err := json.Unmarshal([]byte(s), m); err != nil {
+		return nil, err
+	}
+	if m.Method == "" || m.Sender == "" {
+		return nil, errors.New("invalid watcher message: " + s)
+	}
+	return m, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sort"
+)
+
+// PolicyOp is the operation of a policy change.
+type PolicyOp string
+
+// The operations of the policy changes.
+const (
+	PolicyAdd    PolicyOp = "add"
+	PolicyRemove PolicyOp = "remove"
+	PolicyUpdate PolicyOp = "update"
+	PolicyLoad   PolicyOp = "load"
+	PolicyClear  PolicyOp = "clear"
+)
+
+// PolicySource is what caused a policy change.
+type PolicySource string
+
+// The sources of the policy changes.
+const (
+	// PolicySourceAPI is a call of the management or RBAC API, or a committed transaction.
+	PolicySourceAPI PolicySource = "api"
+	// PolicySourceLoadPolicy is a call of LoadPolicy() or LoadFilteredPolicy().
+	PolicySourceLoadPolicy PolicySource = "load_policy"
+	// PolicySourceWatcher is a reload of the policy notified by the watcher.
+	PolicySourceWatcher PolicySource = "watcher"
+)
+
+// PolicyEvent describes a change of the policy of the enforcer.
+type PolicyEvent struct {
+	Op     PolicyOp
+	Sec    string
+	PType  string
+	Source PolicySource
+	// Rules are the rules added, removed, loaded or cleared. For an update, they are the old rules.
+	Rules [][]string
+	// NewRules are the rules replacing Rules for an update, NewRules[i] replaces Rules[i].
+	NewRules [][]string
+}
+
+// OnPolicyChange registers a handler called after every change of the policy.
+// The handlers are called synchronously in the order they were registered, they must not
+// change the policy and, with a SyncedEnforcer, must not call the enforcer.
+func (e *Enforcer) OnPolicyChange(handler func(evt PolicyEvent)) {
+	e.policyChangeHandlers = append(e.policyChangeHandlers, handler)
+}
+
+func (e *Enforcer) notifyPolicyChange(evt PolicyEvent) {
+	for _, handler := range e.policyChangeHandlers {
+		handler(evt)
+	}
+}
+
+// policyChangeAll returns the events of a change of all the policy types of the model, like a load,
+// the rules are copied so that they are not changed by the later changes of the policy.
+// The empty policy types are not notified when they are cleared.
+func (e *Enforcer) policyChangeAll(op PolicyOp, source PolicySource) []PolicyEvent {
+	if len(e.policyChangeHandlers) == 0 {
+		return nil
+	}
+	var events []PolicyEvent
+	for _, sec := range []string{"p", "g"} {
+		ptypes := make([]string, 0, len(e.model[sec]))
+		for ptype := range e.model[sec] {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes)
+
+		for _, ptype := range ptypes {
+			policy := e.model[sec][ptype].Policy
+			if op == PolicyClear && len(policy) == 0 {
+				continue
+			}
+			events = append(events, PolicyEvent{
+				Op:     op,
+				Sec:    sec,
+				PType:  ptype,
+				Source: source,
+				Rules:  append([][]string(nil), policy...),
+			})
+		}
+	}
+	return events
+}
+
+// notifyPolicyChangeAll notifies a change of all the policy types of the model, like a load.
+func (e *Enforcer) notifyPolicyChangeAll(op PolicyOp, source PolicySource) {
+	for _, evt := range e.policyChangeAll(op, source) {
+		e.notifyPolicyChange(evt)
+	}
+}
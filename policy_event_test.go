@@ -0,0 +1,114 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testWatcher struct {
+	SampleWatcher
+	callback func(string)
+}
+
+func (w *testWatcher) SetUpdateCallback(callback func(string)) error {
+	w.callback = callback
+	return nil
+}
+
+func TestOnPolicyChange(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	var events []PolicyEvent
+	e.OnPolicyChange(func(evt PolicyEvent) {
+		events = append(events, evt)
+	})
+
+	testEvents := func(title string, expected ...PolicyEvent) {
+		t.Helper()
+		if !reflect.DeepEqual(events, expected) {
+			t.Errorf("%s: %+v, supposed to be %+v", title, events, expected)
+		}
+		events = nil
+	}
+
+	e.AddPolicy("eve", "data3", "read")
+	testEvents("AddPolicy", PolicyEvent{Op: PolicyAdd, Sec: "p", PType: "p", Source: PolicySourceAPI,
+		Rules: [][]string{{"eve", "data3", "read"}}})
+	// Nothing changes.
+	e.AddPolicy("eve", "data3", "read")
+	testEvents("AddPolicy")
+
+	e.RemoveGroupingPolicy("alice", "data2_admin")
+	testEvents("RemoveGroupingPolicy", PolicyEvent{Op: PolicyRemove, Sec: "g", PType: "g", Source: PolicySourceAPI,
+		Rules: [][]string{{"alice", "data2_admin"}}})
+
+	e.RemoveFilteredPolicy(0, "data2_admin")
+	testEvents("RemoveFilteredPolicy", PolicyEvent{Op: PolicyRemove, Sec: "p", PType: "p", Source: PolicySourceAPI,
+		Rules: [][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}})
+
+	e.UpdatePolicy([]string{"eve", "data3", "read"}, []string{"eve", "data3", "write"})
+	testEvents("UpdatePolicy", PolicyEvent{Op: PolicyUpdate, Sec: "p", PType: "p", Source: PolicySourceAPI,
+		Rules: [][]string{{"eve", "data3", "read"}}, NewRules: [][]string{{"eve", "data3", "write"}}})
+
+	e.ClearPolicy()
+	testEvents("ClearPolicy",
+		PolicyEvent{Op: PolicyClear, Sec: "p", PType: "p", Source: PolicySourceAPI,
+			Rules: [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"eve", "data3", "write"}}})
+
+	loaded := []PolicyEvent{
+		{Op: PolicyLoad, Sec: "p", PType: "p", Source: PolicySourceLoadPolicy, Rules: [][]string{
+			{"alice", "data1", "read"},
+			{"bob", "data2", "write"},
+			{"data2_admin", "data2", "read"},
+			{"data2_admin", "data2", "write"}}},
+		{Op: PolicyLoad, Sec: "g", PType: "g", Source: PolicySourceLoadPolicy, Rules: [][]string{
+			{"alice", "data2_admin"}}},
+	}
+	e.LoadPolicy()
+	testEvents("LoadPolicy", loaded...)
+
+	w := &testWatcher{}
+	_ = e.SetWatcher(w)
+	w.callback("")
+	loaded[0].Source, loaded[1].Source = PolicySourceWatcher, PolicySourceWatcher
+	testEvents("watcher", loaded...)
+}
+
+func TestOnPolicyChangeSnapshot(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	var events []PolicyEvent
+	var policies [][][]string
+	e.OnPolicyChange(func(evt PolicyEvent) {
+		events = append(events, evt)
+		policies = append(policies, e.GetPolicy())
+	})
+
+	// The handlers see the policy once it is cleared.
+	e.ClearPolicy()
+	if len(events) != 1 || len(events[0].Rules) != 2 || len(policies[0]) != 0 {
+		t.Errorf("ClearPolicy: %+v with the policy %v", events, policies)
+	}
+
+	// The loaded rules are not changed by the later changes of the policy.
+	events = nil
+	e.LoadPolicy()
+	e.RemovePolicy("alice", "data1", "read")
+	e.AddPolicy("eve", "data3", "read")
+	expected := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}
+	if len(events) != 3 || !reflect.DeepEqual(events[0].Rules, expected) {
+		t.Errorf("LoadPolicy: %+v, supposed to load %v", events, expected)
+	}
+}
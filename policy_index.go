@@ -0,0 +1,180 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sync"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// indexClause is an equality like "r.obj == p.obj" every matching policy rule has to satisfy.
+type indexClause struct {
+	rIndex int
+	pField int
+}
+
+// getIndexClauses finds the equalities between a request token and a policy token that the whole
+// matcher depends on, i.e. the ones joined to the rest of the expression with "&&" only.
+func getIndexClauses(tokens []govaluate.ExpressionToken, rTokens map[string]int, pTokens map[string]int) []indexClause {
+	var clauses []indexClause
+	for _, conjunct := range splitConjuncts(tokens) {
+		if isWrappedInClause(conjunct) {
+			clauses = append(clauses, getIndexClauses(conjunct[1:len(conjunct)-1], rTokens, pTokens)...)
+			continue
+		}
+
+		if len(conjunct) != 3 || conjunct[1].Kind != govaluate.COMPARATOR || conjunct[1].Value != "==" ||
+			conjunct[0].Kind != govaluate.VARIABLE || conjunct[2].Kind != govaluate.VARIABLE {
+			continue
+		}
+
+		left, right := conjunct[0].Value.(string), conjunct[2].Value.(string)
+		if rIndex, ok := rTokens[left]; ok {
+			if pField, ok := pTokens[right]; ok {
+				clauses = append(clauses, indexClause{rIndex: rIndex, pField: pField})
+			}
+		} else if rIndex, ok := rTokens[right]; ok {
+			if pField, ok := pTokens[left]; ok {
+				clauses = append(clauses, indexClause{rIndex: rIndex, pField: pField})
+			}
+		}
+	}
+	return clauses
+}
+
+// splitConjuncts splits the tokens on the top level "&&" operators. It returns nil when
+// the top level of the expression is not a conjunction, e.g. it contains "||".
+func splitConjuncts(tokens []govaluate.ExpressionToken) [][]govaluate.ExpressionToken {
+	var conjuncts [][]govaluate.ExpressionToken
+	depth, start := 0, 0
+	for i, token := range tokens {
+		switch token.Kind {
+		case govaluate.CLAUSE:
+			depth++
+		case govaluate.CLAUSE_CLOSE:
+			depth--
+		case govaluate.TERNARY:
+			if depth == 0 {
+				return nil
+			}
+		case govaluate.LOGICALOP:
+			if depth != 0 {
+				continue
+			}
+			if token.Value != "&&" {
+				return nil
+			}
+			conjuncts = append(conjuncts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(conjuncts, tokens[start:])
+}
+
+// isWrappedInClause determines whether the tokens are a single parenthesized expression.
+func isWrappedInClause(tokens []govaluate.ExpressionToken) bool {
+	if len(tokens) < 2 || tokens[0].Kind != govaluate.CLAUSE || tokens[len(tokens)-1].Kind != govaluate.CLAUSE_CLOSE {
+		return false
+	}
+
+	depth := 0
+	for i, token := range tokens {
+		switch token.Kind {
+		case govaluate.CLAUSE:
+			depth++
+		case govaluate.CLAUSE_CLOSE:
+			depth--
+			if depth == 0 && i != len(tokens)-1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fieldIndex maps the values of a policy field to the positions of the rules having them.
+type fieldIndex struct {
+	// generation is the generation of the policy the index was built for, see model.Assertion.Generation().
+	// The index is stale once the policy changed, it is built again when it is used.
+	generation uint64
+	values     map[string][]int
+}
+
+func newFieldIndex(ast *model.Assertion, field int) *fieldIndex {
+	fi := &fieldIndex{generation: ast.Generation(), values: make(map[string][]int)}
+	for i, rule := range ast.Policy {
+		if field < len(rule) {
+			fi.values[rule[field]] = append(fi.values[rule[field]], i)
+		}
+	}
+	return fi
+}
+
+// policyIndex keeps hash indexes on the policy fields compared for equality in matchers,
+// so that only the candidate rules need to be evaluated by enforce.
+type policyIndex struct {
+	mutex sync.RWMutex
+	// ptype -> policy field -> index
+	fields map[string]map[int]*fieldIndex
+}
+
+func newPolicyIndex() *policyIndex {
+	return &policyIndex{fields: make(map[string]map[int]*fieldIndex)}
+}
+
+// candidates returns the ascending positions of the rules of the policy ast of ptype whose field
+// is equal to value, the index for the field is built on first use and after the policy changed.
+func (pi *policyIndex) candidates(ptype string, ast *model.Assertion, field int, value string) []int {
+	generation := ast.Generation()
+	pi.mutex.RLock()
+	fi, ok := pi.fields[ptype][field]
+	pi.mutex.RUnlock()
+
+	if !ok || fi.generation != generation {
+		pi.mutex.Lock()
+		fi, ok = pi.fields[ptype][field]
+		if !ok || fi.generation != generation {
+			fi = newFieldIndex(ast, field)
+			if _, ok := pi.fields[ptype]; !ok {
+				pi.fields[ptype] = make(map[int]*fieldIndex)
+			}
+			pi.fields[ptype][field] = fi
+		}
+		pi.mutex.Unlock()
+	}
+
+	return fi.values[value]
+}
+
+// appendRule records that the last rule of the policy ast of ptype was appended to it, so that
+// the indexes built for the previous generation of the policy are kept instead of being built again.
+func (pi *policyIndex) appendRule(ptype string, ast *model.Assertion, generation uint64) {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	pos := len(ast.Policy) - 1
+	rule := ast.Policy[pos]
+	for field, fi := range pi.fields[ptype] {
+		if fi.generation != generation {
+			continue
+		}
+		if field < len(rule) {
+			fi.values[rule[field]] = append(fi.values[rule[field]], pos)
+		}
+		fi.generation = ast.Generation()
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/util"
+)
+
+func testIndexClauses(t *testing.T, matcher string, res []indexClause) {
+	t.Helper()
+	functions := map[string]govaluate.ExpressionFunction{
+		"g":        util.GenerateGFunction(nil),
+		"keyMatch": util.KeyMatchFunc,
+	}
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(matcher, functions)
+	if err != nil {
+		t.Fatalf("%s: %s", matcher, err)
+	}
+
+	rTokens := map[string]int{"r_sub": 0, "r_obj": 1, "r_act": 2}
+	pTokens := map[string]int{"p_sub": 0, "p_obj": 1, "p_act": 2}
+	myRes := getIndexClauses(expression.Tokens(), rTokens, pTokens)
+	if !reflect.DeepEqual(myRes, res) {
+		t.Errorf("%s: %v, supposed to be %v", matcher, myRes, res)
+	}
+}
+
+func TestGetIndexClauses(t *testing.T) {
+	testIndexClauses(t, "r_sub == p_sub && r_obj == p_obj && r_act == p_act",
+		[]indexClause{{0, 0}, {1, 1}, {2, 2}})
+	testIndexClauses(t, "g(r_sub, p_sub) && p_obj == r_obj && keyMatch(r_act, p_act)",
+		[]indexClause{{1, 1}})
+	testIndexClauses(t, "(r_sub == p_sub && r_obj == p_obj) && r_act == p_act",
+		[]indexClause{{0, 0}, {1, 1}, {2, 2}})
+	testIndexClauses(t, "(r_sub == p_sub || r_sub == \"root\") && r_obj == p_obj",
+		[]indexClause{{1, 1}})
+	testIndexClauses(t, "r_sub == p_sub && r_obj == p_obj || r_sub == \"root\"", nil)
+	testIndexClauses(t, "r_sub != p_sub && r_obj == \"data1\" && p_obj == p_act", nil)
+	testIndexClauses(t, "!(r_sub == p_sub && r_obj == p_obj)", nil)
+}
+
+func TestPolicyIndexMaintenance(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	unindexed := "r_sub == p_sub && r_obj == p_obj && r_act == p_act || false"
+
+	check := func() {
+		t.Helper()
+		for _, sub := range []string{"alice", "bob", "cathy"} {
+			for _, obj := range []string{"data1", "data2", "data3"} {
+				for _, act := range []string{"read", "write"} {
+					res, _ := e.Enforce(sub, obj, act)
+					expected, _ := e.EnforceWithMatcher(unindexed, sub, obj, act)
+					if res != expected {
+						t.Errorf("%s, %s, %s: %t, supposed to be %t", sub, obj, act, res, expected)
+					}
+				}
+			}
+		}
+	}
+
+	check()
+	e.AddPolicy("cathy", "data3", "read")
+	e.AddPolicy("alice", "data2", "write")
+	check()
+	e.RemovePolicy("alice", "data1", "read")
+	check()
+	e.RemoveFilteredPolicy(1, "data2")
+	check()
+	e.AddPolicy("bob", "data1", "read")
+	e.AddPolicy("bob", "data1", "write")
+	e.RemovePolicy("cathy", "data3", "read")
+	check()
+	e.ClearPolicy()
+	check()
+	e.LoadPolicy()
+	check()
+
+	// Changes done to the model directly are detected as well, even when the policy keeps its length.
+	e.GetModel().AddPolicy("p", "p", []string{"cathy", "data1", "read"})
+	testEnforce(t, e, "cathy", "data1", "read", true)
+	check()
+	e.GetModel().UpdatePolicy("p", "p", []string{"cathy", "data1", "read"}, []string{"cathy", "data2", "read"})
+	testEnforce(t, e, "cathy", "data1", "read", false)
+	testEnforce(t, e, "cathy", "data2", "read", true)
+	check()
+	e.GetModel()["p"]["p"].Policy[0] = []string{"cathy", "data3", "write"}
+	e.GetModel().IndexPolicies()
+	testEnforce(t, e, "cathy", "data3", "write", true)
+	check()
+
+	// A rule added again after it was removed is indexed at its new position.
+	e.AddPolicy("bob", "data3", "read")
+	e.RemovePolicy("bob", "data3", "read")
+	e.AddPolicy("bob", "data3", "read")
+	check()
+}
+
+func BenchmarkIndexedEnforce(b *testing.B) {
+	e, _ := NewEnforcer("examples/basic_model.conf", false)
+	for i := 0; i < 10000; i++ {
+		e.AddPolicy(fmt.Sprintf("user%d", i), fmt.Sprintf("data%d", i/10), "read")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = e.Enforce("user5001", "data500", "read")
+	}
+}
@@ -139,7 +139,7 @@ func (e *Enforcer) GetImplicitRolesForUser(name string, domain ...string) ([]str
 		name := q[0]
 		q = q[1:]
 
-		roles, err := e.rm.GetRoles(name, domain...)
+		roles, err := e.GetRoleManager().GetRoles(name, domain...)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,148 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"math"
+	"regexp"
+	"sort"
+
+	"github.com/casbin/casbin/v2/effect"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/rbac"
+)
+
+// sortBySubjectPriority sorts the effects of the matching rules for "subjectPriority(p_eft)": a rule of the
+// subject of the request comes first, then the rules of its roles, then the rules of the roles of its roles, etc.
+// The roles are the ones of the role definition the matcher calls for the subject, e.g. "g2" for
+// "g2(r.sub, p.sub)", without one only the rules of the subject come first.
+// The rules at the same distance keep their order. It returns the original position of every effect,
+// or nil if the subject of the request is not a string.
+func (e *Enforcer) sortBySubjectPriority(ec EnforceContext, cm *compiledMatcher, rvals []interface{},
+	policy [][]string, candidates []int, effects []effect.Effect, results []float64) []int {
+	rIndex, ok := cm.rTokens[ec.RType+"_sub"]
+	if !ok {
+		rIndex = 0
+	}
+	subject, ok := rvals[rIndex].(string)
+	if !ok {
+		return nil
+	}
+	pIndex, ok := cm.pTokens[ec.PType+"_sub"]
+	if !ok {
+		pIndex = 0
+	}
+	domainIndex, hasDomain := cm.pTokens[ec.PType+"_dom"]
+
+	// The distances from the subject of the request to its roles, per domain.
+	distances := map[string]map[string]int{}
+	distance := func(rule []string) int {
+		key, domain := "", []string(nil)
+		if hasDomain {
+			key = rule[domainIndex]
+			domain = []string{key}
+		}
+		if _, ok := distances[key]; !ok {
+			distances[key] = getRoleDistances(e.rmMap[cm.subjectRoleType], subject, domain...)
+		}
+		if d, ok := distances[key][rule[pIndex]]; ok {
+			return d
+		}
+		return math.MaxInt32
+	}
+
+	ranks := make([]int, len(effects))
+	order := make([]int, len(effects))
+	for i, eft := range effects {
+		order[i] = i
+		ranks[i] = math.MaxInt32
+		if eft == effect.Indeterminate {
+			continue
+		}
+		rule := policy[i]
+		if candidates != nil {
+			rule = policy[candidates[i]]
+		}
+		ranks[i] = distance(rule)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return ranks[order[a]] < ranks[order[b]]
+	})
+
+	sortedEffects := make([]effect.Effect, len(effects))
+	sortedResults := make([]float64, len(results))
+	for i, j := range order {
+		sortedEffects[i] = effects[j]
+		sortedResults[i] = results[j]
+	}
+	copy(effects, sortedEffects)
+	copy(results, sortedResults)
+	return order
+}
+
+// getSubjectToken returns the token of the subject of the request, "r_sub" or else the first one.
+func getSubjectToken(ec EnforceContext, tokens []string) string {
+	for _, token := range tokens {
+		if token == ec.RType+"_sub" {
+			return token
+		}
+	}
+	if len(tokens) == 0 {
+		return ""
+	}
+	return tokens[0]
+}
+
+// getSubjectRoleType returns the role definition the matcher calls with the subject token as its first
+// argument, i.e. the one giving the roles of the subject, or "" if there is none.
+func getSubjectRoleType(matcher string, subjectToken string, roleTypes model.AssertionMap) string {
+	if subjectToken == "" {
+		return ""
+	}
+	calls := regexp.MustCompile(`\b(\w+)\(\s*` + regexp.QuoteMeta(subjectToken) + `\s*[,)]`)
+	for _, call := range calls.FindAllStringSubmatch(matcher, -1) {
+		if _, ok := roleTypes[call[1]]; ok {
+			return call[1]
+		}
+	}
+	return ""
+}
+
+// getRoleDistances returns the number of inheritance steps from the subject to each of its roles,
+// the subject itself is at distance 0.
+func getRoleDistances(rm rbac.RoleManager, subject string, domain ...string) map[string]int {
+	distances := map[string]int{subject: 0}
+	if rm == nil {
+		return distances
+	}
+
+	queue := []string{subject}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		roles, err := rm.GetRoles(name, domain...)
+		if err != nil {
+			continue
+		}
+		for _, role := range roles {
+			if _, ok := distances[role]; !ok {
+				distances[role] = distances[name] + 1
+				queue = append(queue, role)
+			}
+		}
+	}
+	return distances
+}
@@ -0,0 +1,282 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// Transaction stages policy changes that are applied together when it is committed.
+// The changes are saved by the adapter before they are applied to the model, so that the model
+// and the storage do not disagree when the adapter fails.
+type Transaction struct {
+	enforcer *Enforcer
+	// locker is held while the transaction is committed, e.g. the lock of a SyncedEnforcer.
+	locker     sync.Locker
+	operations []transactionOperation
+	done       bool
+}
+
+// transactionOperation is a staged addition or removal of a rule.
+type transactionOperation struct {
+	add   bool
+	sec   string
+	ptype string
+	rule  []string
+}
+
+// BeginTransaction starts a transaction, the changes staged in it are applied by Commit().
+func (e *Enforcer) BeginTransaction() *Transaction {
+	return &Transaction{enforcer: e}
+}
+
+func toRule(params []interface{}) []string {
+	if strSlice, ok := params[0].([]string); len(params) == 1 && ok {
+		return strSlice
+	}
+	rule := make([]string, 0, len(params))
+	for _, param := range params {
+		rule = append(rule, param.(string))
+	}
+	return rule
+}
+
+func (tx *Transaction) stage(add bool, sec string, ptype string, rule []string) {
+	tx.operations = append(tx.operations, transactionOperation{add: add, sec: sec, ptype: ptype, rule: rule})
+}
+
+// AddPolicy stages the addition of an authorization rule.
+func (tx *Transaction) AddPolicy(params ...interface{}) {
+	tx.AddNamedPolicy("p", params...)
+}
+
+// AddNamedPolicy stages the addition of an authorization rule to a named policy.
+func (tx *Transaction) AddNamedPolicy(ptype string, params ...interface{}) {
+	tx.stage(true, "p", ptype, toRule(params))
+}
+
+// RemovePolicy stages the removal of an authorization rule.
+func (tx *Transaction) RemovePolicy(params ...interface{}) {
+	tx.RemoveNamedPolicy("p", params...)
+}
+
+// RemoveNamedPolicy stages the removal of an authorization rule from a named policy.
+func (tx *Transaction) RemoveNamedPolicy(ptype string, params ...interface{}) {
+	tx.stage(false, "p", ptype, toRule(params))
+}
+
+// AddGroupingPolicy stages the addition of a role inheritance rule.
+func (tx *Transaction) AddGroupingPolicy(params ...interface{}) {
+	tx.AddNamedGroupingPolicy("g", params...)
+}
+
+// AddNamedGroupingPolicy stages the addition of a named role inheritance rule.
+func (tx *Transaction) AddNamedGroupingPolicy(ptype string, params ...interface{}) {
+	tx.stage(true, "g", ptype, toRule(params))
+}
+
+// RemoveGroupingPolicy stages the removal of a role inheritance rule.
+func (tx *Transaction) RemoveGroupingPolicy(params ...interface{}) {
+	tx.RemoveNamedGroupingPolicy("g", params...)
+}
+
+// RemoveNamedGroupingPolicy stages the removal of a named role inheritance rule.
+func (tx *Transaction) RemoveNamedGroupingPolicy(ptype string, params ...interface{}) {
+	tx.stage(false, "g", ptype, toRule(params))
+}
+
+// Rollback discards the staged changes.
+func (tx *Transaction) Rollback() error {
+	if tx.done {
+		return errors.New("transaction has already been committed or rolled back")
+	}
+	tx.done = true
+	tx.operations = nil
+	return nil
+}
+
+// Commit applies the staged changes. Like AddPolicy() and RemovePolicy(), adding an existing
+// rule or removing a missing one changes nothing. The changes are saved by the adapter first,
+// in a single transaction if it is a persist.TransactionalAdapter, then applied to the model
+// and the watcher is notified once, or sent the operations if it is a persist.WatcherEx.
+// If the adapter fails, the model is not changed.
+func (tx *Transaction) Commit() error {
+	if tx.done {
+		return errors.New("transaction has already been committed or rolled back")
+	}
+	tx.done = true
+
+	if tx.locker != nil {
+		tx.locker.Lock()
+		defer tx.locker.Unlock()
+	}
+	e := tx.enforcer
+
+	operations, err := tx.effectiveOperations()
+	if err != nil || len(operations) == 0 {
+		return err
+	}
+
+	if e.adapter != nil && e.autoSave {
+		if err := tx.save(operations); err != nil {
+			return err
+		}
+	}
+
+	rebuildRoleLinks := false
+	for _, op := range operations {
+		if op.add {
+			e.model.AddPolicy(op.sec, op.ptype, op.rule)
+		} else {
+			e.model.RemovePolicy(op.sec, op.ptype, op.rule)
+		}
+		if op.sec == "g" {
+			rebuildRoleLinks = true
+		}
+	}
+	if rebuildRoleLinks && e.autoBuildRoleLinks {
+		if err := e.BuildRoleLinks(); err != nil {
+			return err
+		}
+	}
+	for _, op := range operations {
+		evt := PolicyEvent{Op: PolicyRemove, Sec: op.sec, PType: op.ptype, Source: PolicySourceAPI, Rules: [][]string{op.rule}}
+		if op.add {
+			evt.Op = PolicyAdd
+		}
+		e.notifyPolicyChange(evt)
+	}
+
+	if e.adapter != nil && e.autoSave && e.watcher != nil {
+		return tx.notifyWatcher(operations)
+	}
+	return nil
+}
+
+// notifyWatcher notifies the watcher of the committed operations. A persist.WatcherEx is sent
+// the operations, the consecutive ones of the same kind in one batch, so that the other instances
+// apply them without reloading the policy.
+func (tx *Transaction) notifyWatcher(operations []transactionOperation) error {
+	e := tx.enforcer
+	watcher, ok := e.watcher.(persist.WatcherEx)
+	if !ok {
+		return e.watcher.Update()
+	}
+
+	for start := 0; start < len(operations); {
+		op := operations[start]
+		rules := [][]string{op.rule}
+		end := start + 1
+		for ; end < len(operations); end++ {
+			next := operations[end]
+			if next.add != op.add || next.sec != op.sec || next.ptype != op.ptype {
+				break
+			}
+			rules = append(rules, next.rule)
+		}
+		start = end
+
+		var err error
+		if op.add {
+			err = watcher.UpdateForAddPolicies(op.sec, op.ptype, rules...)
+		} else {
+			err = watcher.UpdateForRemovePolicies(op.sec, op.ptype, rules...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// effectiveOperations returns the staged operations that change the policy,
+// taking the previous operations of the transaction into account.
+func (tx *Transaction) effectiveOperations() ([]transactionOperation, error) {
+	e := tx.enforcer
+	staged := map[string]bool{}
+	var operations []transactionOperation
+	for _, op := range tx.operations {
+		if _, ok := e.model[op.sec][op.ptype]; !ok {
+			return nil, errors.New("policy type " + op.ptype + " is not defined in the model")
+		}
+		if op.add {
+			if err := e.model.CheckPriority(op.sec, op.ptype, op.rule); err != nil {
+				return nil, err
+			}
+		}
+
+		key := op.sec + "\x1f" + op.ptype + "\x1f" + strings.Join(op.rule, "\x1f")
+		exists, ok := staged[key]
+		if !ok {
+			exists = e.model.HasPolicy(op.sec, op.ptype, op.rule)
+		}
+		if exists == op.add {
+			continue
+		}
+		staged[key] = op.add
+		operations = append(operations, op)
+	}
+	return operations, nil
+}
+
+// save saves the operations with the adapter. If it does not support transactions,
+// the operations are saved one by one and the ones already saved are reverted when one fails.
+func (tx *Transaction) save(operations []transactionOperation) error {
+	e := tx.enforcer
+	if adapter, ok := e.adapter.(persist.TransactionalAdapter); ok {
+		atx, err := adapter.BeginTransaction()
+		if err != nil {
+			return err
+		}
+		for _, op := range operations {
+			if op.add {
+				err = atx.AddPolicy(op.sec, op.ptype, op.rule)
+			} else {
+				err = atx.RemovePolicy(op.sec, op.ptype, op.rule)
+			}
+			if err != nil {
+				_ = atx.Rollback()
+				return err
+			}
+		}
+		return atx.Commit()
+	}
+
+	for i, op := range operations {
+		var err error
+		if op.add {
+			err = e.adapter.AddPolicy(op.sec, op.ptype, op.rule)
+		} else {
+			err = e.adapter.RemovePolicy(op.sec, op.ptype, op.rule)
+		}
+		if err == nil || err.Error() == notImplemented {
+			continue
+		}
+
+		for j := i - 1; j >= 0; j-- {
+			if saved := operations[j]; saved.add {
+				_ = e.adapter.RemovePolicy(saved.sec, saved.ptype, saved.rule)
+			} else {
+				_ = e.adapter.AddPolicy(saved.sec, saved.ptype, saved.rule)
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2/persist"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/casbin/casbin/v2/util"
+)
+
+func TestTransaction(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	tx := e.BeginTransaction()
+	tx.RemoveGroupingPolicy("alice", "data2_admin")
+	tx.AddGroupingPolicy("alice", "data1_admin")
+	tx.AddPolicy("data1_admin", "data1", "write")
+	tx.AddNamedPolicy("p", []string{"data1_admin", "data3", "read"})
+	// The changes are not visible before the commit.
+	testEnforce(t, e, "alice", "data2", "read", true)
+	testEnforce(t, e, "alice", "data1", "write", false)
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data2", "read", false)
+	testEnforce(t, e, "alice", "data1", "write", true)
+	testEnforce(t, e, "alice", "data3", "read", true)
+	if err := tx.Commit(); err == nil {
+		t.Error("a transaction should not be committed twice")
+	}
+
+	tx = e.BeginTransaction()
+	tx.RemovePolicy("data1_admin", "data1", "write")
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data1", "write", true)
+
+	// The operations are applied in order.
+	tx = e.BeginTransaction()
+	tx.AddPolicy("eve", "data3", "read")
+	tx.RemovePolicy("eve", "data3", "read")
+	tx.RemovePolicy("bob", "data2", "write")
+	tx.AddPolicy("bob", "data2", "write")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	testHasPolicy(t, e, []string{"eve", "data3", "read"}, false)
+	testHasPolicy(t, e, []string{"bob", "data2", "write"}, true)
+}
+
+type failingAdapter struct {
+	*fileadapter.Adapter
+	rules [][]string
+	fail  []string
+}
+
+func (a *failingAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	if util.ArrayEquals(rule, a.fail) {
+		return errors.New("storage failure")
+	}
+	a.rules = append(a.rules, rule)
+	return nil
+}
+
+func (a *failingAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	for i, r := range a.rules {
+		if util.ArrayEquals(r, rule) {
+			a.rules = append(a.rules[:i], a.rules[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func TestTransactionAdapterFailure(t *testing.T) {
+	a := &failingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv"), fail: []string{"eve", "data3", "write"}}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	tx := e.BeginTransaction()
+	tx.AddPolicy("eve", "data3", "read")
+	tx.AddPolicy("eve", "data3", "write")
+	if err := tx.Commit(); err == nil {
+		t.Fatal("the commit should fail")
+	}
+	// Neither the model nor the storage are changed.
+	testHasPolicy(t, e, []string{"eve", "data3", "read"}, false)
+	if len(a.rules) != 0 {
+		t.Errorf("the storage has %v", a.rules)
+	}
+}
+
+type transactionalAdapter struct {
+	*fileadapter.Adapter
+	transactions int
+	commits      int
+}
+
+type adapterTransaction struct {
+	adapter    *transactionalAdapter
+	operations int
+}
+
+func (a *transactionalAdapter) BeginTransaction() (persist.Transaction, error) {
+	a.transactions++
+	return &adapterTransaction{adapter: a}, nil
+}
+
+func (tx *adapterTransaction) AddPolicy(sec string, ptype string, rule []string) error {
+	tx.operations++
+	return nil
+}
+
+func (tx *adapterTransaction) RemovePolicy(sec string, ptype string, rule []string) error {
+	tx.operations++
+	return nil
+}
+
+func (tx *adapterTransaction) Commit() error {
+	if tx.operations != 2 {
+		return errors.New("unexpected operations")
+	}
+	tx.adapter.commits++
+	return nil
+}
+
+func (tx *adapterTransaction) Rollback() error {
+	return nil
+}
+
+func TestTransactionalAdapter(t *testing.T) {
+	a := &transactionalAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewSyncedEnforcer("examples/rbac_model.conf", a)
+	w := &countingWatcher{}
+	_ = e.SetWatcher(w)
+
+	tx := e.BeginTransaction()
+	tx.AddPolicy("eve", "data3", "read")
+	tx.AddPolicy("eve", "data3", "read")
+	tx.RemoveGroupingPolicy("alice", "data2_admin")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if a.transactions != 1 || a.commits != 1 || w.updates != 1 {
+		t.Errorf("%d transactions, %d commits and %d watcher updates, supposed to be 1, 1 and 1",
+			a.transactions, a.commits, w.updates)
+	}
+	testEnforceSync(t, e, "eve", "data3", "read", true)
+	testEnforceSync(t, e, "alice", "data2", "read", false)
+}
@@ -20,17 +20,18 @@ import (
 	"strings"
 )
 
+var escapeAssertionRegex = regexp.MustCompile(`(^|\||&|<|>|=|!|\+|-|\*|/|,| |\(|\))((?:r|p)[0-9]*)\.`)
+var unescapeAssertionRegex = regexp.MustCompile(`(^|\||&|<|>|=|!|\+|-|\*|/|,| |\(|\))((?:r|p)[0-9]*)_`)
+
 // EscapeAssertion escapes the dots in the assertion, because the expression evaluation doesn't support such variable names.
+// Numbered definitions like "r2.sub" or "p2.sub" are escaped as well.
 func EscapeAssertion(s string) string {
-	//Replace the first dot, because it can't be recognized by the regexp.
-	if (strings.HasPrefix(s, "r") || strings.HasPrefix(s, "p")) {
-		s = strings.Replace(s, ".", "_",1)
-	}
-	var regex = regexp.MustCompile(`(\|| |=|\)|\(|&|<|>|,|\+|-|!|\*|\/)(r|p)\.`)
-	s = regex.ReplaceAllStringFunc(s, func(m string) string {
-		return strings.Replace(m, ".", "_", 1)
-	})
-	return s
+	return escapeAssertionRegex.ReplaceAllString(s, "${1}${2}_")
+}
+
+// UnescapeAssertion reverts EscapeAssertion, e.g. "r_sub == p_sub" becomes "r.sub == p.sub" again.
+func UnescapeAssertion(s string) string {
+	return unescapeAssertionRegex.ReplaceAllString(s, "${1}${2}.")
 }
 
 // RemoveComments removes the comments starting with # in the text.
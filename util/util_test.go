@@ -26,6 +26,10 @@ func testEscapeAssertion(t *testing.T, s string, res string) {
 	if myRes != res {
 		t.Errorf("%s: %s, supposed to be %s", s, myRes, res)
 	}
+
+	if myRes = UnescapeAssertion(res); myRes != s {
+		t.Errorf("%s: %s, supposed to be unescaped as %s", res, myRes, s)
+	}
 }
 
 func TestEscapeAssertion(t *testing.T) {
@@ -42,6 +46,9 @@ func TestEscapeAssertion(t *testing.T) {
 	testEscapeAssertion(t, "g(r.sub, p.sub) == p.attr", "g(r_sub, p_sub) == p_attr")
 	testEscapeAssertion(t, "g(r.sub,p.sub) == p.attr", "g(r_sub,p_sub) == p_attr")
 	testEscapeAssertion(t, "(r.attp.value || p.attr)p.u", "(r_attp.value || p_attr)p_u")
+	testEscapeAssertion(t, "r2.sub == p2.sub && r2.obj.id == p2.obj", "r2_sub == p2_sub && r2_obj.id == p2_obj")
+	testEscapeAssertion(t, "regexMatch(r.act, p.act) && keyMatch2(r.obj, p.obj)", "regexMatch(r_act, p_act) && keyMatch2(r_obj, p_obj)")
+	testEscapeAssertion(t, "r.sub == \"root\" || priority(p.eft)", "r_sub == \"root\" || priority(p_eft)")
 }
 
 func testRemoveComments(t *testing.T, s string, res string) {
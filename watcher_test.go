@@ -14,7 +14,19 @@
 
 package casbin
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/casbin/casbin/v2/persist/watcher/filewatcher"
+	"github.com/casbin/casbin/v2/persist/watcher/inmemory"
+)
 
 type SampleWatcher struct {
 }
@@ -39,3 +51,234 @@ func TestSetWatcher(t *testing.T) {
 
 	e.SavePolicy() //calls watcher.Update()
 }
+
+func TestInMemoryWatcher(t *testing.T) {
+	a := fileadapter.NewAdapter("examples/rbac_policy.csv")
+	e1, _ := NewSyncedEnforcer("examples/rbac_model.conf", a)
+	e2, _ := NewSyncedEnforcer("examples/rbac_model.conf", a)
+	b := inmemory.NewBroker()
+	w1, w2 := b.NewWatcher(), b.NewWatcher()
+	_ = e1.SetWatcher(w1)
+	_ = e2.SetWatcher(w2)
+
+	e1.AddPolicy("eve", "data3", "read")
+	e2.AddGroupingPolicy("eve", "data2_admin")
+	e1.RemovePolicy("alice", "data1", "read")
+	b.Flush()
+
+	for _, e := range []*SyncedEnforcer{e1, e2} {
+		testEnforceSync(t, e, "eve", "data3", "read", true)
+		testEnforceSync(t, e, "eve", "data2", "write", true)
+		testEnforceSync(t, e, "alice", "data1", "read", false)
+	}
+
+	// The closed watcher does not receive the changes any more.
+	w2.Close()
+	e1.AddPolicy("jack", "data4", "read")
+	b.Flush()
+	testEnforceSync(t, e2, "jack", "data4", "read", false)
+	w1.Close()
+}
+
+// sampleWatcherEx passes the messages to the callback of its peer.
+type sampleWatcherEx struct {
+	SampleWatcher
+	name     string
+	seq      uint64
+	peer     *sampleWatcherEx
+	callback func(string)
+	// drop is set to lose the next message.
+	drop bool
+}
+
+func (w *sampleWatcherEx) SetUpdateCallback(callback func(string)) error {
+	w.callback = callback
+	return nil
+}
+
+func (w *sampleWatcherEx) send(m persist.WatcherMessage) error {
+	w.seq++
+	m.Sender, m.Seq = w.name, w.seq
+	if w.drop {
+		w.drop = false
+		return nil
+	}
+	w.peer.callback(m.String())
+	return nil
+}
+
+func (w *sampleWatcherEx) Update() error {
+	return w.send(persist.WatcherMessage{Method: persist.Update})
+}
+
+func (w *sampleWatcherEx) UpdateForAddPolicy(sec string, ptype string, params ...string) error {
+	return w.send(persist.WatcherMessage{Method: persist.UpdateForAddPolicy, Sec: sec, PType: ptype, Params: params})
+}
+
+func (w *sampleWatcherEx) UpdateForRemovePolicy(sec string, ptype string, params ...string) error {
+	return w.send(persist.WatcherMessage{Method: persist.UpdateForRemovePolicy, Sec: sec, PType: ptype, Params: params})
+}
+
+func (w *sampleWatcherEx) UpdateForRemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.send(persist.WatcherMessage{Method: persist.UpdateForRemoveFilteredPolicy, Sec: sec, PType: ptype,
+		FieldIndex: fieldIndex, Params: fieldValues})
+}
+
+func (w *sampleWatcherEx) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return w.send(persist.WatcherMessage{Method: persist.UpdateForAddPolicies, Sec: sec, PType: ptype, Rules: rules})
+}
+
+func (w *sampleWatcherEx) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return w.send(persist.WatcherMessage{Method: persist.UpdateForRemovePolicies, Sec: sec, PType: ptype, Rules: rules})
+}
+
+func (w *sampleWatcherEx) UpdateForUpdatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) error {
+	return w.send(persist.WatcherMessage{Method: persist.UpdateForUpdatePolicies, Sec: sec, PType: ptype,
+		Rules: oldRules, NewRules: newRules})
+}
+
+func (w *sampleWatcherEx) UpdateForSavePolicy(model model.Model) error {
+	return w.send(persist.WatcherMessage{Method: persist.UpdateForSavePolicy})
+}
+
+type loadCountingAdapter struct {
+	*fileadapter.Adapter
+	loads int
+}
+
+func (a *loadCountingAdapter) LoadPolicy(model model.Model) error {
+	a.loads++
+	return a.Adapter.LoadPolicy(model)
+}
+
+func TestWatcherEx(t *testing.T) {
+	e1, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	a := &loadCountingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e2, _ := NewEnforcer("examples/rbac_model.conf", a)
+	w1, w2 := &sampleWatcherEx{name: "e1"}, &sampleWatcherEx{name: "e2"}
+	w1.peer, w2.peer = w2, w1
+	_ = e1.SetWatcher(w1)
+	_ = e2.SetWatcher(w2)
+	a.loads = 0
+
+	// The changes are applied without reloading the policy.
+	e1.AddPolicy("eve", "data3", "read")
+	e1.AddGroupingPolicy("eve", "data2_admin")
+	e1.RemovePolicy("alice", "data1", "read")
+	e1.RemoveFilteredPolicy(1, "data2", "write")
+	if a.loads != 0 {
+		t.Errorf("the policy was reloaded %d times", a.loads)
+	}
+	testEnforce(t, e2, "eve", "data3", "read", true)
+	testEnforce(t, e2, "eve", "data2", "read", true)
+	testEnforce(t, e2, "alice", "data1", "read", false)
+	testEnforce(t, e2, "bob", "data2", "write", false)
+	testGetPolicy(t, e2, e1.GetPolicy())
+
+	e1.UpdatePolicy([]string{"eve", "data3", "read"}, []string{"eve", "data3", "write"})
+	e1.UpdatePolicies([][]string{{"data2_admin", "data2", "read"}}, [][]string{{"data2_admin", "data3", "read"}})
+	if a.loads != 0 {
+		t.Errorf("the policy was reloaded %d times", a.loads)
+	}
+	testEnforce(t, e2, "eve", "data3", "write", true)
+	testEnforce(t, e2, "eve", "data2", "read", false)
+	testEnforce(t, e2, "alice", "data3", "read", true)
+	testGetPolicy(t, e2, e1.GetPolicy())
+
+	e1.AddPolicies([][]string{{"jack", "data4", "read"}, {"jack", "data5", "read"}})
+	e1.AddGroupingPolicies([][]string{{"jack", "data2_admin"}})
+	e1.RemovePolicies([][]string{{"jack", "data5", "read"}})
+	if a.loads != 0 {
+		t.Errorf("the policy was reloaded %d times", a.loads)
+	}
+	testEnforce(t, e2, "jack", "data4", "read", true)
+	testEnforce(t, e2, "jack", "data5", "read", false)
+	testEnforce(t, e2, "jack", "data3", "read", true)
+	testGetPolicy(t, e2, e1.GetPolicy())
+
+	// The operations of a transaction are sent too.
+	tx := e1.BeginTransaction()
+	tx.AddPolicy("kate", "data6", "read")
+	tx.AddPolicy("kate", "data7", "read")
+	tx.RemoveGroupingPolicy("jack", "data2_admin")
+	tx.RemovePolicy("jack", "data4", "read")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if a.loads != 0 {
+		t.Errorf("the policy was reloaded %d times", a.loads)
+	}
+	testEnforce(t, e2, "kate", "data7", "read", true)
+	testEnforce(t, e2, "jack", "data3", "read", false)
+	testEnforce(t, e2, "jack", "data4", "read", false)
+	testGetPolicy(t, e2, e1.GetPolicy())
+	testGetGroupingPolicy(t, e2, e1.GetGroupingPolicy())
+
+	// A missed message reloads the policy.
+	w1.drop = true
+	e1.AddPolicy("leyo", "data4", "read")
+	e1.AddPolicy("leyo", "data5", "read")
+	if a.loads != 1 {
+		t.Errorf("the policy was reloaded %d times, supposed to be 1", a.loads)
+	}
+
+	// A plain update reloads the policy.
+	w1.Update()
+	if a.loads != 2 {
+		t.Errorf("the policy was reloaded %d times, supposed to be 2", a.loads)
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "casbin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.csv")
+	policy, _ := ioutil.ReadFile("examples/basic_policy.csv")
+	_ = ioutil.WriteFile(path, policy, 0644)
+
+	// The file is polled by the test, the watcher does not poll it itself within the test.
+	e, _ := NewSyncedEnforcer("examples/basic_model.conf", path)
+	w, err := filewatcher.NewWatcher(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	_ = e.SetWatcher(w)
+	reloads := 0
+	e.OnPolicyChange(func(evt PolicyEvent) {
+		if evt.Op == PolicyLoad && evt.Source == PolicySourceWatcher {
+			reloads++
+		}
+	})
+	now := time.Now()
+	poll := func() {
+		w.Poll(now)
+		w.Poll(now.Add(time.Hour))
+		now = now.Add(2 * time.Hour)
+	}
+
+	// The policy saved by the enforcer is not reloaded.
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_ = e.SavePolicy()
+	poll()
+	if reloads != 0 {
+		t.Errorf("%d reloads, supposed to be 0", reloads)
+	}
+
+	// A change of the file is reloaded, even if the enforcer changes its policy before it is seen.
+	_ = ioutil.WriteFile(path, []byte("p, alice, data1, write\n"), 0644)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(path, later, later)
+	_, _ = e.AddPolicy("frank", "data3", "read")
+	poll()
+	if reloads != 1 {
+		t.Errorf("%d reloads, supposed to be 1", reloads)
+	}
+	testEnforceSync(t, e, "alice", "data1", "write", true)
+	testEnforceSync(t, e, "alice", "data1", "read", false)
+	testEnforceSync(t, e, "eve", "data3", "read", false)
+	testEnforceSync(t, e, "frank", "data3", "read", false)
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// onWatcherUpdate is the update callback of the watcher. The change of a persist.WatcherMessage is
+// applied to the model without reloading the policy, unless a previous message of its sender was
+// missed. Any other message reloads the whole policy.
+func (e *Enforcer) onWatcherUpdate(msg string) error {
+	m, err := persist.ParseWatcherMessage(msg)
+	if err != nil {
+		return e.loadPolicy(PolicySourceWatcher)
+	}
+
+	if e.watcherSeqs == nil {
+		e.watcherSeqs = map[string]uint64{}
+	}
+	last, known := e.watcherSeqs[m.Sender]
+	// A sequence starting again at 1 is a restarted sender, the other older messages were already received.
+	if known && m.Seq <= last && m.Seq != 1 {
+		return nil
+	}
+	e.watcherSeqs[m.Sender] = m.Seq
+	if known && m.Seq > last+1 {
+		return e.loadPolicy(PolicySourceWatcher)
+	}
+
+	if _, ok := e.model[m.Sec][m.PType]; !ok {
+		return e.loadPolicy(PolicySourceWatcher)
+	}
+	// The batches change nothing when the policy of the receiver differs from the one of the sender,
+	// the policy is reloaded then.
+	applied := true
+	switch m.Method {
+	case persist.UpdateForAddPolicy:
+		_, err = e.addPolicyToModel(m.Sec, m.PType, m.Params, PolicySourceWatcher)
+	case persist.UpdateForRemovePolicy:
+		e.removePolicyFromModel(m.Sec, m.PType, m.Params, PolicySourceWatcher)
+	case persist.UpdateForRemoveFilteredPolicy:
+		e.removeFilteredPolicyFromModel(m.Sec, m.PType, m.FieldIndex, m.Params, PolicySourceWatcher)
+	case persist.UpdateForAddPolicies:
+		applied, err = e.addPoliciesToModel(m.Sec, m.PType, m.Rules, PolicySourceWatcher)
+	case persist.UpdateForRemovePolicies:
+		applied = e.removePoliciesFromModel(m.Sec, m.PType, m.Rules, PolicySourceWatcher)
+	case persist.UpdateForUpdatePolicies:
+		applied, err = e.updatePoliciesInModel(m.Sec, m.PType, m.Rules, m.NewRules, PolicySourceWatcher)
+	default:
+		return e.loadPolicy(PolicySourceWatcher)
+	}
+	if err != nil || !applied {
+		return e.loadPolicy(PolicySourceWatcher)
+	}
+
+	if m.Sec == "g" && e.autoBuildRoleLinks {
+		return e.BuildRoleLinks()
+	}
+	return nil
+}